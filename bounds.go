@@ -0,0 +1,25 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	boundsMode  = flag.String("bounds", "unbounded", "keep boids in bounds: unbounded, wrap, bounce or soft")
+	boundsShape = flag.String("bounds-shape", "box", "shape of the bounds: box or sphere")
+	boundsSize  = flag.Float64("bounds-size", 40, "half size of the bounds box or radius of the sphere")
+)
+
+// applyBounds configures the bounds from flags.
+func applyBounds(settings *sim.Settings) error {
+	if err := settings.Bounds.UnmarshalText([]byte(*boundsMode)); err != nil {
+		return err
+	}
+	if err := settings.BoundsShape.UnmarshalText([]byte(*boundsShape)); err != nil {
+		return err
+	}
+	settings.BoundsSize = float32(*boundsSize)
+	return nil
+}
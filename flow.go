@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"unsafe"
+
+	"github.com/adinfinit/g"
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	flowPreset = flag.String("flow", "none", "ambient flow: none, wind, vortex, curl or all")
+	flowFile   = flag.String("flow-file", "", "load an ambient flow vector grid from file")
+	flowArrows = flag.Bool("flow-arrows", false, "show the ambient flow as arrows, toggle with F")
+)
+
+// applyFlow adds the ambient flow fields from flags.
+func applyFlow(flock *sim.Flock) error {
+	wind := &sim.Wind{Velocity: g.V3(1.5, 0, 0), Gust: g.V3(1, 0, 1), Frequency: 0.5}
+	vortex := &sim.Vortex{Axis: g.V3(0, 1, 0), Radius: 12, Strength: 6}
+	curl := &sim.CurlNoise{Scale: 15, Strength: 3, Speed: 0.2}
+
+	switch *flowPreset {
+	case "none":
+	case "wind":
+		flock.AddField(wind)
+	case "vortex":
+		flock.AddField(vortex)
+	case "curl":
+		flock.AddField(curl)
+	case "all":
+		flock.AddField(wind)
+		flock.AddField(vortex)
+		flock.AddField(curl)
+	default:
+		return fmt.Errorf("unknown flow %q", *flowPreset)
+	}
+
+	if *flowFile != "" {
+		file, err := os.Open(*flowFile)
+		if err != nil {
+			return fmt.Errorf("unable to open flow file: %w", err)
+		}
+		defer file.Close()
+
+		grid, err := sim.ReadVectorGrid(file)
+		if err != nil {
+			return err
+		}
+		flock.AddField(grid)
+	}
+	return nil
+}
+
+// FlowRenderer draws the ambient flow as arrows sampled on a grid.
+type FlowRenderer struct {
+	Program uint32
+	VAO     uint32
+	VBO     uint32
+
+	projectionView int32
+
+	lines []flowVertex
+}
+
+type flowVertex struct {
+	Position g.Vec3
+	Color    g.Vec3
+}
+
+const (
+	flowVertexBytes = int32(unsafe.Sizeof(flowVertex{}))
+	// flowSamples is the number of arrows on each axis.
+	flowSamples = 10
+	// flowExtent is the half size of the sampled area, unless bounds are set.
+	flowExtent = 30
+)
+
+func NewFlowRenderer() (*FlowRenderer, error) {
+	program, err := newProgram(flowVertexShader, fragmentShader, "")
+	if err != nil {
+		return nil, err
+	}
+
+	renderer := &FlowRenderer{Program: program}
+	renderer.projectionView = gl.GetUniformLocation(program, gl.Str("ProjectionViewMatrix\x00"))
+	gl.BindFragDataLocation(program, 0, gl.Str("OutputColor\x00"))
+
+	gl.GenVertexArrays(1, &renderer.VAO)
+	gl.BindVertexArray(renderer.VAO)
+
+	gl.GenBuffers(1, &renderer.VBO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, renderer.VBO)
+
+	positionAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexPosition\x00")))
+	gl.EnableVertexAttribArray(positionAttrib)
+	gl.VertexAttribPointer(positionAttrib, 3, gl.FLOAT, false, flowVertexBytes, gl.PtrOffset(0))
+
+	colorAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexColor\x00")))
+	gl.EnableVertexAttribArray(colorAttrib)
+	gl.VertexAttribPointer(colorAttrib, 3, gl.FLOAT, false, flowVertexBytes, gl.PtrOffset(3*4))
+
+	return renderer, nil
+}
+
+// Draw samples the fields of the flock and draws them as arrows.
+func (renderer *FlowRenderer) Draw(flock *sim.Flock, camera *Camera) {
+	if len(flock.Fields) == 0 {
+		return
+	}
+
+	extent := float32(flowExtent)
+	if flock.Settings.Bounds != sim.Unbounded && flock.Settings.BoundsSize > 0 {
+		extent = flock.Settings.BoundsSize
+	}
+	spacing := 2 * extent / flowSamples
+
+	tail, head := g.V3(0.1, 0.2, 0.4), g.V3(0.5, 0.9, 1)
+	renderer.lines = renderer.lines[:0]
+	for z := 0; z < flowSamples; z++ {
+		for y := 0; y < flowSamples; y++ {
+			for x := 0; x < flowSamples; x++ {
+				p := g.V3(float32(x)+0.5, float32(y)+0.5, float32(z)+0.5).Mul(spacing).Sub(g.V3(extent, extent, extent))
+				v := g.Vec3{}
+				for _, field := range flock.Fields {
+					v = v.Add(field.At(p, flock.Time))
+				}
+				length := v.Len()
+				if length < 1e-3 {
+					continue
+				}
+
+				// one second of flow, limited to the spacing
+				tip := p.Add(v.Mul(g.Min(1, 0.8*spacing/length)))
+				u, w := orthonormalBasis(v.Mul(1 / length))
+				back := tip.Lerp(p, 0.3)
+				barb := tip.Sub(back).Len() * 0.5
+
+				renderer.lines = append(renderer.lines,
+					flowVertex{p, tail}, flowVertex{tip, head},
+					flowVertex{tip, head}, flowVertex{back.Add(u.Mul(barb)), head},
+					flowVertex{tip, head}, flowVertex{back.Add(w.Mul(barb)), head},
+				)
+			}
+		}
+	}
+	if len(renderer.lines) == 0 {
+		return
+	}
+
+	gl.UseProgram(renderer.Program)
+	gl.UniformMatrix4fv(renderer.projectionView, 1, false, camera.ProjectionView.Ptr())
+
+	gl.BindVertexArray(renderer.VAO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, renderer.VBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(renderer.lines)*int(flowVertexBytes), gl.Ptr(renderer.lines), gl.STREAM_DRAW)
+	gl.DrawArrays(gl.LINES, 0, int32(len(renderer.lines)))
+}
+
+var flowVertexShader = `
+#version 330
+
+uniform mat4 ProjectionViewMatrix;
+
+in vec3 VertexPosition;
+in vec3 VertexColor;
+
+out vec3 FragmentColor;
+
+void main() {
+	gl_Position = ProjectionViewMatrix * vec4(VertexPosition, 1);
+	FragmentColor = VertexColor;
+}
+` + "\x00"
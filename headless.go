@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/loov/hrtime"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	headless = flag.Bool("headless", false, "run simulation without a window")
+	frames   = flag.Int("frames", 1000, "number of frames to simulate in headless mode")
+)
+
+func runHeadless() {
+	flock := sim.NewFlock(*count, *seed)
+	defer flock.Close()
+	flock.Procs = *procs
+	if *neighborhood {
+		flock.Settings.Mode = sim.Neighborhood
+	}
+	if err := applyBounds(&flock.Settings); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyIntegrator(&flock.Settings); err != nil {
+		log.Fatal(err)
+	}
+	flock.SpawnPredators(*predatorCount)
+	if err := addDemoSpecies(flock, *speciesCount); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyTargets(flock); err != nil {
+		log.Fatal(err)
+	}
+	if err := applyFlow(flock); err != nil {
+		log.Fatal(err)
+	}
+	if *loadPath != "" {
+		if err := loadSnapshot(flock, *loadPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	render := defaultRenderSettings()
+	watcher, err := startSettings(flock, &render)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := startTimeline(flock); err != nil {
+		log.Fatal(err)
+	}
+	if err := startHealth(flock); err != nil {
+		log.Fatal(err)
+	}
+	flock.MetricsInterval = *metricsInterval
+
+	var demo *DemoObstacles
+	if *obstacleDemo {
+		demo = addDemoObstacles(flock)
+	}
+
+	stopRecording, err := startRecording(flock)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var total sim.Timing
+
+	start := hrtime.Now()
+	for i := 0; i < *frames; i++ {
+		watcher.Update(flock, &render)
+		if demo != nil {
+			demo.Update(flock.Time)
+		}
+		flock.Step(float32(*fixedDelta))
+		total.Add(&flock.Timing)
+		if flock.Frame%100 == 0 {
+			printTiming(&flock.Timing)
+		}
+		if *metricsInterval > 0 && flock.Frame%*metricsInterval == 0 {
+			printMetrics(&flock.LastMetrics)
+		}
+	}
+	stop := hrtime.Now()
+
+	if err := stopRecording(); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("\nsimulated %d boids for %d frames in %v\n", flock.Count(), *frames, stop-start)
+	fmt.Println("average:")
+	average := total.Div(*frames)
+	printTiming(&average)
+	if *metricsInterval > 0 {
+		fmt.Println("final metrics:")
+		metrics := flock.Metrics()
+		printMetrics(&metrics)
+	}
+
+	if *savePath != "" {
+		if err := saveSnapshot(flock, *savePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
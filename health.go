@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	healthMode = flag.String("health", "off", "check for NaN and Inf after each phase: off, panic or respawn")
+	healthDump = flag.String("health-dump", "", "snapshot file written on the first fault found by -health")
+)
+
+// startHealth configures the health checks from flags.
+func startHealth(flock *sim.Flock) error {
+	health := &sim.Health{}
+	switch *healthMode {
+	case "off":
+		return nil
+	case "panic":
+	case "respawn":
+		health.Respawn = true
+	default:
+		return fmt.Errorf("unknown health mode %q", *healthMode)
+	}
+
+	dumped := false
+	health.OnFault = func(flock *sim.Flock, fault *sim.Fault) {
+		log.Println(fault)
+		if *healthDump == "" || dumped {
+			return
+		}
+		dumped = true
+		if err := saveSnapshot(flock, *healthDump); err != nil {
+			log.Println(err)
+			return
+		}
+		log.Println("saved snapshot", *healthDump)
+	}
+	flock.Health = health
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	integrator  = flag.String("integrator", "semi-implicit", "integrator moving the boids: euler, semi-implicit, verlet or rk4")
+	maxStep     = flag.Float64("max-step", 1.0/30.0, "split longer steps into substeps, 0 never splits")
+	maxSubsteps = flag.Int("max-substeps", 8, "maximum number of substeps per step")
+)
+
+// applyIntegrator configures the integrator from flags.
+func applyIntegrator(settings *sim.Settings) error {
+	if err := settings.Integrator.UnmarshalText([]byte(*integrator)); err != nil {
+		return err
+	}
+	settings.MaxStep = float32(*maxStep)
+	settings.MaxSubsteps = int32(*maxSubsteps)
+	return nil
+}
@@ -5,21 +5,18 @@ import (
 	"fmt"
 	_ "image/png"
 	"log"
-	"math"
-	"math/rand"
 	"os"
 	"runtime"
 	"runtime/pprof"
-	"strconv"
-	"sync/atomic"
 	"unsafe"
 
 	"github.com/adinfinit/g"
 	"github.com/go-gl/gl/v3.3-core/gl"
 	"github.com/go-gl/glfw/v3.3/glfw"
 
-	"github.com/egonelbre/async"
 	"github.com/loov/hrtime"
+
+	"github.com/adinfit/boids/sim"
 )
 
 var (
@@ -29,276 +26,126 @@ var (
 	windowHeight = flag.Int("height", 600, "window height")
 
 	procs = flag.Int("p", runtime.GOMAXPROCS(-1), "parallelism")
-)
+	count = flag.Int("n", sim.DefaultCount, "number of boids")
+	seed  = flag.Int64("seed", 0, "random seed")
+
+	neighborhood = flag.Bool("neighborhood", false, "steer using all neighbors instead of cell averages")
 
-const (
-	BoidsBatchSize = 1000000
-	HashThreads    = 2
+	fixed      = flag.Bool("fixed", false, "step simulation with a fixed time step instead of frame time")
+	fixedDelta = flag.Float64("dt", 1.0/60.0, "fixed time step, used with -fixed and -headless")
 )
 
 type Boids struct {
-	VBO uint32
-
-	Settings struct {
-		CellRadius       float32
-		SeparationWeight float32
-		AlignmentWeight  float32
-		TargetWeight     float32
-	}
-
-	*GPUBoids
+	VBO     uint32
+	Program uint32
 
-	Speed     [BoidsBatchSize]float32
-	CellIndex [BoidsBatchSize]int32
+	// Capacity is the number of boids the VBO has been allocated for.
+	Capacity int
+	// ShowFlow draws the ambient flow as arrows.
+	ShowFlow bool
 
-	Targets []g.Vec3
+	Render RenderSettings
+	// Watcher reloads the settings file, nil without one.
+	Watcher *SettingsWatcher
 
-	CellHash       [HashThreads]map[int32][]int32
-	CellIndices    [][]int32
-	CellTarget     []g.Vec3
-	CellAlignment  []g.Vec3
-	CellSeparation []g.Vec3
+	*sim.Flock
 }
 
-type GPUBoids struct {
-	Position [BoidsBatchSize]g.Vec3
-	Heading  [BoidsBatchSize]g.Vec3
+func printTiming(timing *sim.Timing) {
+	fmt.Printf("%-15s: %v\n", "hashPositions", timing.HashPositions)
+	fmt.Printf("%-15s: %v\n", "resizeCells", timing.ResizeCells)
+	fmt.Printf("%-15s: %v\n", "computeCells", timing.ComputeCells)
+	fmt.Printf("%-15s: %v\n", "steerAndMove", timing.SteerAndMove)
+	fmt.Printf("%-15s: %v\n", "---", timing.Total)
 }
 
-func (boids *Boids) randomize() {
-	for i := range boids.Position {
-		boids.Position[i] = g.V3(
-			rand.Float32()*40-20,
-			rand.Float32()*40-20,
-			rand.Float32()*40-20,
-		)
-		boids.Heading[i] = g.V3(
-			rand.Float32()-0.5,
-			rand.Float32()-0.5,
-			rand.Float32()-0.5,
-		).Normalize()
-		boids.Speed[i] = 5 + rand.Float32()*3
-	}
-}
-
-func (boids *Boids) initData() {
-	boids.GPUBoids = &GPUBoids{}
-	for i := range boids.CellHash {
-		boids.CellHash[i] = make(map[int32][]int32, BoidsBatchSize/10)
-	}
+const Vec3Size = int(unsafe.Sizeof(g.Vec3{}))
 
-	boids.Settings.CellRadius = 5
-	boids.Settings.SeparationWeight = 0.5
-	boids.Settings.AlignmentWeight = 1
-	boids.Settings.TargetWeight = 0.5
-
-	boids.Targets = []g.Vec3{{}, {}, {}}
+func (boids *Boids) size() int {
+	return boids.Count() * Vec3Size
 }
 
-var frame int
-
-func bench(name string) func() {
-	start := hrtime.Now()
-	return func() {
-		stop := hrtime.Now()
-		if frame%100 == 0 {
-			fmt.Printf("%-15s: %v\n", name, stop-start)
-		}
+func (boids *Boids) Init(program uint32, count int) {
+	boids.Flock = sim.NewFlock(count, *seed)
+	boids.Procs = *procs
+	boids.Program = program
+	if *neighborhood {
+		boids.Settings.Mode = sim.Neighborhood
 	}
-}
-
-func (boids *Boids) Simulate(world *World) {
-	frame++
-
-	sn, cs := math.Sincos(float64(world.Time * 0.1))
-
-	boids.Targets[0] = g.V3(
-		0,
-		float32(cs)*20,
-		float32(sn)*20,
-	)
-
-	boids.Targets[1] = g.V3(
-		float32(sn)*25,
-		0,
-		float32(cs)*25,
-	)
-
-	boids.Targets[2] = g.V3(
-		-float32(cs)*30,
-		float32(sn)*30,
-		0,
-	)
-	boids.Settings.CellRadius = 5 + 2*g.Sin(float32(world.Time))
-
-	boids.Settings.TargetWeight = 1
-
-	for _, table := range boids.CellHash {
-		for hash, list := range table {
-			table[hash] = list[:0]
-		}
+	if err := applyBounds(&boids.Settings); err != nil {
+		log.Fatal(err)
 	}
-
-	defer bench("---")()
-	boids.hashPositions(boids.Settings.CellRadius)
-	boids.resizeCells()
-	boids.computeCells(world)
-	boids.steerAndMove(world)
-}
-
-func (boids *Boids) hashPositions(radius float32) {
-	defer bench("hashPositions")()
-
-	index := int32(0)
-	async.BlockIter(len(boids.Position), HashThreads, func(start, limit int) {
-		tid := atomic.AddInt32(&index, 1) - 1
-
-		cellhash := boids.CellHash[tid]
-
-		invradius := 1 / radius
-		for offset, p := range boids.Position[start:limit] {
-			x, y, z := int32(p.X*invradius), int32(p.Y*invradius), int32(p.Z*invradius)
-
-			hash := x
-			hash += (hash * 397) ^ y
-			hash += (hash * 397) ^ z
-			hash += hash << 3
-			hash ^= hash >> 11
-			hash += hash << 15
-
-			cellhash[hash] = append(cellhash[hash], int32(start+offset))
-		}
-	})
-
-	merge := boids.CellHash[0]
-	for _, table := range boids.CellHash[1:] {
-		for hash, indices := range table {
-			merge[hash] = append(merge[hash], indices...)
-		}
+	if err := applyIntegrator(&boids.Settings); err != nil {
+		log.Fatal(err)
 	}
-}
-
-func (boids *Boids) resizeCells() {
-	defer bench("resizeCells")()
-
-	cellCount := len(boids.CellHash[0])
-
-	if cap(boids.CellAlignment) < cellCount {
-		boids.CellAlignment = make([]g.Vec3, cellCount)
-		boids.CellSeparation = make([]g.Vec3, cellCount)
-		boids.CellTarget = make([]g.Vec3, cellCount)
-		boids.CellIndices = make([][]int32, cellCount)
+	boids.SpawnPredators(*predatorCount)
+	if err := addDemoSpecies(boids.Flock, *speciesCount); err != nil {
+		log.Fatal(err)
 	}
-
-	boids.CellAlignment = boids.CellAlignment[:cellCount]
-	boids.CellSeparation = boids.CellSeparation[:cellCount]
-	boids.CellTarget = boids.CellTarget[:cellCount]
-	boids.CellIndices = boids.CellIndices[:cellCount]
-
-	nextIndex := 0
-	for _, indices := range boids.CellHash[0] {
-		boids.CellIndices[nextIndex] = indices
-		nextIndex++
+	if err := applyTargets(boids.Flock); err != nil {
+		log.Fatal(err)
 	}
-}
-
-func (boids *Boids) computeCells(world *World) {
-	defer bench("computeCells")()
-
-	async.Iter(len(boids.CellIndices), *procs, func(cellIndex int) {
-		if len(boids.CellIndices[cellIndex]) == 0 {
-			return
-		}
-
-		indices := boids.CellIndices[cellIndex]
-
-		alignment := g.Vec3{}
-		separation := g.Vec3{}
-
-		for _, boidIndex := range indices {
-			boids.CellIndex[boidIndex] = int32(cellIndex)
-			alignment = alignment.Add(boids.Heading[boidIndex])
-			separation = separation.Add(boids.Position[boidIndex])
-		}
-
-		byCount := 1.0 / float32(len(indices))
-		center := separation.Mul(byCount)
-		boids.CellAlignment[cellIndex] = alignment.Mul(byCount)
-		boids.CellSeparation[cellIndex] = center
-
-		nearest := boids.Targets[0]
-		nearestDistance2 := center.Sub(boids.Targets[0]).Len2()
-		for _, target := range boids.Targets[1:] {
-			dist2 := center.Sub(target).Len2()
-			if dist2 < nearestDistance2 {
-				nearest = target
-				nearestDistance2 = dist2
-			}
-		}
-		boids.CellTarget[cellIndex] = nearest
-	})
-}
-
-func check(t string, ps ...g.Vec3) {
-	for i, p := range ps {
-		if math.IsNaN(float64(p.X)) || math.IsNaN(float64(p.Y)) || math.IsNaN(float64(p.Z)) {
-			fmt.Println(ps)
-			panic(t + "=" + strconv.Itoa(i))
+	if err := applyFlow(boids.Flock); err != nil {
+		log.Fatal(err)
+	}
+	boids.ShowFlow = *flowArrows
+	if *loadPath != "" {
+		if err := loadSnapshot(boids.Flock, *loadPath); err != nil {
+			log.Fatal(err)
 		}
 	}
-}
 
-func safeNormalize(v g.Vec3, s float32) g.Vec3 {
-	l := v.Len2()
-	if l < 1e-3 {
-		return g.V3(0, 0, s)
+	boids.Render = defaultRenderSettings()
+	watcher, err := startSettings(boids.Flock, &boids.Render)
+	if err != nil {
+		log.Fatal(err)
 	}
-	return v.Mul(s / g.Sqrt(l))
-}
-
-func (boids *Boids) steerAndMove(world *World) {
-	defer bench("steerAndMove")()
-	dt := world.DeltaTime
-
-	async.BlockIter(len(boids.Position), *procs, func(start, limit int) {
-		for offset := range boids.Position[start:limit] {
-			i := start + offset
-			cell := boids.CellIndex[i]
-			pos := boids.Position[i]
-			head := boids.Heading[i]
-
-			cellSeparation := boids.CellSeparation[cell]
-			cellAlignment := boids.CellAlignment[cell]
-			cellTarget := boids.CellTarget[cell]
-
-			separation := safeNormalize(pos.Sub(cellSeparation), boids.Settings.SeparationWeight)
-			target := safeNormalize(cellTarget.Sub(pos), boids.Settings.TargetWeight)
-			alignment := safeNormalize(cellAlignment.Sub(head), boids.Settings.AlignmentWeight)
-
-			normalHeading := safeNormalize(alignment.Add(separation).Add(target), 1)
-			newHeading := safeNormalize(head.Add(normalHeading.Sub(head).Mul(dt)), 1)
-			boids.Heading[i] = newHeading
+	boids.Watcher = watcher
+	if err := startTimeline(boids.Flock); err != nil {
+		log.Fatal(err)
+	}
+	if err := startHealth(boids.Flock); err != nil {
+		log.Fatal(err)
+	}
+	boids.MetricsInterval = *metricsInterval
 
-			boids.Position[i] = boids.Position[i].Add(newHeading.Mul(dt * boids.Speed[i]))
-		}
-	})
+	gl.GenBuffers(1, &boids.VBO)
+	boids.allocate()
 }
 
-func (boids *Boids) Count() int { return BoidsBatchSize }
+// allocate reserves VBO for the current boid count,
+// expects the mesh VAO to be bound.
+func (boids *Boids) allocate() {
+	boids.Capacity = boids.Count()
 
-func (boids *Boids) size() int {
-	return int(unsafe.Sizeof(*boids.GPUBoids))
+	gl.BindBuffer(gl.ARRAY_BUFFER, boids.VBO)
+	gl.BufferData(gl.ARRAY_BUFFER, 2*boids.size(), nil, gl.DYNAMIC_DRAW)
+
+	boids.attribVec3(boids.Program, "InstancePosition", 0)
+	boids.attribVec3(boids.Program, "InstanceHeading", uintptr(boids.size()))
 }
-func (boids *Boids) Init(program uint32) {
-	boids.initData()
-	boids.randomize()
 
-	gl.GenBuffers(1, &boids.VBO)
+// Draw draws each species with its own size and color,
+// expects the mesh VAO to be bound and the boid program to be in use.
+func (boids *Boids) Draw(indexCount int, sizeUniform, tintUniform int32) {
 	gl.BindBuffer(gl.ARRAY_BUFFER, boids.VBO)
-	gl.BufferData(gl.ARRAY_BUFFER, boids.size(), unsafe.Pointer(boids.GPUBoids), gl.DYNAMIC_DRAW)
+	for k, species := range boids.Species {
+		start, limit := boids.SpeciesRange(k)
+		if start == limit {
+			continue
+		}
+
+		// there is no base instance in GL 3.3, so offset the instance data instead
+		boids.attribVec3(boids.Program, "InstancePosition", uintptr(start*Vec3Size))
+		boids.attribVec3(boids.Program, "InstanceHeading", uintptr(boids.size()+start*Vec3Size))
 
-	boids.attribVec3(program, "InstancePosition", unsafe.Offsetof(boids.GPUBoids.Position))
-	boids.attribVec3(program, "InstanceHeading", unsafe.Offsetof(boids.GPUBoids.Heading))
+		gl.Uniform1f(sizeUniform, species.Size)
+		gl.Uniform4f(tintUniform, species.Color.X, species.Color.Y, species.Color.Z, species.Color.W)
+		gl.DrawElementsInstanced(
+			gl.TRIANGLES, int32(indexCount), gl.UNSIGNED_SHORT, gl.PtrOffset(0),
+			int32(limit-start),
+		)
+	}
 }
 
 func (boids *Boids) attribVec3(program uint32, name string, offset uintptr) {
@@ -322,9 +169,67 @@ func (boids *Boids) attribFloat(program uint32, name string, offset uintptr) {
 	gl.VertexAttribDivisor(attrib, 1)
 }
 
+// Upload copies boid state to the VBO,
+// expects the mesh VAO to be bound.
 func (boids *Boids) Upload() {
+	if boids.Capacity != boids.Count() {
+		boids.allocate()
+	}
+	if boids.Count() == 0 {
+		return
+	}
+
 	gl.BindBuffer(gl.ARRAY_BUFFER, boids.VBO)
-	gl.BufferSubData(gl.ARRAY_BUFFER, 0, boids.size(), unsafe.Pointer(boids.GPUBoids))
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, boids.size(), gl.Ptr(boids.Position))
+	gl.BufferSubData(gl.ARRAY_BUFFER, boids.size(), boids.size(), gl.Ptr(boids.Heading))
+}
+
+func (boids *Boids) onKey(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+	if action == glfw.Release {
+		return
+	}
+
+	switch key {
+	case glfw.KeyEqual, glfw.KeyKPAdd:
+		boids.Resize(boids.Count()*2 + 1)
+	case glfw.KeyMinus, glfw.KeyKPSubtract:
+		boids.Resize(boids.Count() / 2)
+	case glfw.KeyM:
+		if boids.Settings.Mode == sim.CellAverage {
+			boids.Settings.Mode = sim.Neighborhood
+		} else {
+			boids.Settings.Mode = sim.CellAverage
+		}
+		log.Println("mode", boids.Settings.Mode)
+	case glfw.KeyP:
+		if mods&glfw.ModShift != 0 {
+			if len(boids.Predators) > 0 {
+				boids.RemovePredator(len(boids.Predators) - 1)
+			}
+		} else {
+			boids.SpawnPredators(1)
+		}
+		log.Println("predators", len(boids.Predators))
+	case glfw.KeyB:
+		boids.Settings.Bounds = (boids.Settings.Bounds + 1) % (sim.Soft + 1)
+		log.Println("bounds", boids.Settings.Bounds)
+	case glfw.KeyF:
+		boids.ShowFlow = !boids.ShowFlow
+	case glfw.Key1, glfw.Key2, glfw.Key3, glfw.Key4, glfw.Key5,
+		glfw.Key6, glfw.Key7, glfw.Key8, glfw.Key9:
+		index := int(key - glfw.Key1)
+		if index < len(boids.Behaviors) {
+			behavior := &boids.Behaviors[index]
+			behavior.Enabled = !behavior.Enabled
+			log.Println("behavior", behavior.Name, "enabled:", behavior.Enabled)
+		}
+	case glfw.KeyS:
+		if err := saveSnapshot(boids.Flock, snapshotPath()); err != nil {
+			log.Println(err)
+		} else {
+			log.Println("saved snapshot", snapshotPath())
+		}
+	}
 }
 
 const Mat4Size = 16 * 4
@@ -346,6 +251,11 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if *headless {
+		runHeadless()
+		return
+	}
+
 	if err := glfw.Init(); err != nil {
 		log.Fatalln("failed to initialize glfw:", err)
 	}
@@ -388,40 +298,49 @@ func main() {
 	projectionViewUniform := gl.GetUniformLocation(boidProgram, gl.Str("ProjectionViewMatrix\x00"))
 
 	diffuseLightPositionUniform := gl.GetUniformLocation(boidProgram, gl.Str("DiffuseLightPosition\x00"))
+	sizeUniform := gl.GetUniformLocation(boidProgram, gl.Str("Size\x00"))
+	tintUniform := gl.GetUniformLocation(boidProgram, gl.Str("Tint\x00"))
+	swimSpeedUniform := gl.GetUniformLocation(boidProgram, gl.Str("SwimSpeed\x00"))
+	swimRollOffsetUniform := gl.GetUniformLocation(boidProgram, gl.Str("SwimRollOffset\x00"))
 
 	gl.BindFragDataLocation(boidProgram, 0, gl.Str("OutputColor\x00"))
 
 	mesh := defaultMesh
 
 	// setup instance data
-	var meshVAO uint32
-	gl.GenVertexArrays(1, &meshVAO)
-	gl.BindVertexArray(meshVAO)
-
-	var meshVBO uint32
-	gl.GenBuffers(1, &meshVBO)
-	gl.BindBuffer(gl.ARRAY_BUFFER, meshVBO)
-	gl.BufferData(gl.ARRAY_BUFFER, len(mesh.Vertices)*int(MeshVertexBytes), gl.Ptr(mesh.Vertices), gl.STATIC_DRAW)
-
-	meshPositionAttrib := uint32(gl.GetAttribLocation(boidProgram, gl.Str("VertexPosition\x00")))
-	gl.EnableVertexAttribArray(meshPositionAttrib)
-	gl.VertexAttribPointer(meshPositionAttrib, 3, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(0))
+	meshVAO := newMeshVAO(boidProgram, &mesh)
 
-	meshNormalAttrib := uint32(gl.GetAttribLocation(boidProgram, gl.Str("VertexNormal\x00")))
-	gl.EnableVertexAttribArray(meshNormalAttrib)
-	gl.VertexAttribPointer(meshNormalAttrib, 3, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(3*4))
-
-	meshUVAttrib := uint32(gl.GetAttribLocation(boidProgram, gl.Str("VertexUV\x00")))
-	gl.EnableVertexAttribArray(meshUVAttrib)
-	gl.VertexAttribPointer(meshUVAttrib, 2, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(3*4+3*4))
+	boids := &Boids{}
+	boids.Init(boidProgram, *count)
+	defer boids.Close()
+	window.SetKeyCallback(boids.onKey)
+	if err := animateView(boids.Timeline, world, boids.Time); err != nil {
+		log.Fatal(err)
+	}
 
-	var meshIBO uint32
-	gl.GenBuffers(1, &meshIBO)
-	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, meshIBO)
-	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, 2*len(mesh.Indices), gl.Ptr(mesh.Indices), gl.STATIC_DRAW)
+	var demo *DemoObstacles
+	if *obstacleDemo {
+		demo = addDemoObstacles(boids.Flock)
+	}
+	predatorRenderer := NewPredatorRenderer(boidProgram)
+	obstacleRenderer, err := NewObstacleRenderer()
+	if err != nil {
+		panic(err)
+	}
+	flowRenderer, err := NewFlowRenderer()
+	if err != nil {
+		panic(err)
+	}
 
-	boids := &Boids{}
-	boids.Init(boidProgram)
+	stopRecording, err := startRecording(boids.Flock)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		if err := stopRecording(); err != nil {
+			log.Println(err)
+		}
+	}()
 
 	// Configure global settings
 	gl.Enable(gl.DEPTH_TEST)
@@ -434,7 +353,11 @@ func main() {
 	gl.ClearColor(0, 0, 0, 1.0)
 	log.Println("ERROR: ", gl.GetError())
 
+	clock := sim.NewFixedStep(float32(*fixedDelta))
+
 	angle := float32(0.0)
+	// viewFailed is set after the first camera or light error is reported
+	viewFailed := false
 	for !window.ShouldClose() {
 		gl.Clear(gl.COLOR_BUFFER_BIT | gl.DEPTH_BUFFER_BIT)
 
@@ -443,16 +366,43 @@ func main() {
 		world.Camera.Eye.X = sn * 30.0
 		world.Camera.Eye.Z = cs * 30.0
 		world.DiffuseLightPosition = g.Z3
+		if err := animateView(boids.Timeline, world, boids.Time); err != nil && !viewFailed {
+			viewFailed = true
+			log.Printf("unable to animate timeline %q: %v", *timelinePath, err)
+		}
 
 		world.NextFrameGLFW(window)
 
 		// Update
 		simStart := hrtime.Now()
-		boids.Simulate(world)
+		boids.Watcher.Update(boids.Flock, &boids.Render)
+		if demo != nil {
+			demo.Update(boids.Time)
+		}
+		if *fixed {
+			for steps := clock.Advance(world.DeltaTime); steps > 0; steps-- {
+				boids.Step(clock.Delta)
+				if boids.Frame%100 == 0 {
+					printTiming(&boids.Timing)
+				}
+				if *metricsInterval > 0 && boids.Frame%*metricsInterval == 0 {
+					printMetrics(&boids.LastMetrics)
+				}
+			}
+		} else {
+			boids.Step(world.DeltaTime)
+			if boids.Frame%100 == 0 {
+				printTiming(&boids.Timing)
+			}
+			if *metricsInterval > 0 && boids.Frame%*metricsInterval == 0 {
+				printMetrics(&boids.LastMetrics)
+			}
+		}
 		simStop := hrtime.Now()
 
 		// Rendering
 		renderStart := hrtime.Now()
+		gl.BindVertexArray(meshVAO)
 		boids.Upload()
 
 		gl.UseProgram(boidProgram)
@@ -462,13 +412,20 @@ func main() {
 		gl.UniformMatrix4fv(viewUniform, 1, false, world.Camera.View.Ptr())
 		gl.UniformMatrix4fv(projectionViewUniform, 1, false, world.Camera.ProjectionView.Ptr())
 		gl.Uniform3fv(diffuseLightPositionUniform, 1, world.DiffuseLightPosition.Ptr())
+		gl.Uniform1f(swimSpeedUniform, boids.Render.SwimSpeed)
+		gl.Uniform1f(swimRollOffsetUniform, boids.Render.SwimRollOffset)
 
 		gl.BindVertexArray(meshVAO)
+		boids.Draw(len(mesh.Indices), sizeUniform, tintUniform)
 
-		gl.DrawElementsInstanced(
-			gl.TRIANGLES, int32(len(mesh.Indices)), gl.UNSIGNED_SHORT, gl.PtrOffset(0),
-			int32(boids.Count()),
-		)
+		gl.Uniform1f(sizeUniform, predatorSize)
+		gl.Uniform4f(tintUniform, predatorTint.X, predatorTint.Y, predatorTint.Z, predatorTint.W)
+		predatorRenderer.Draw(boids.Predators)
+
+		obstacleRenderer.Draw(boids.Obstacles, &world.Camera)
+		if boids.ShowFlow {
+			flowRenderer.Draw(boids.Flock, &world.Camera)
+		}
 		// gl.Finish()
 
 		renderStop := hrtime.Now()
@@ -481,6 +438,38 @@ func main() {
 	}
 }
 
+// newMeshVAO creates a vertex array with the mesh attributes of program,
+// the vertex array is left bound for setting up the instance attributes.
+func newMeshVAO(program uint32, mesh *MeshData) uint32 {
+	var meshVAO uint32
+	gl.GenVertexArrays(1, &meshVAO)
+	gl.BindVertexArray(meshVAO)
+
+	var meshVBO uint32
+	gl.GenBuffers(1, &meshVBO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, meshVBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(mesh.Vertices)*int(MeshVertexBytes), gl.Ptr(mesh.Vertices), gl.STATIC_DRAW)
+
+	meshPositionAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexPosition\x00")))
+	gl.EnableVertexAttribArray(meshPositionAttrib)
+	gl.VertexAttribPointer(meshPositionAttrib, 3, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(0))
+
+	meshNormalAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexNormal\x00")))
+	gl.EnableVertexAttribArray(meshNormalAttrib)
+	gl.VertexAttribPointer(meshNormalAttrib, 3, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(3*4))
+
+	meshUVAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexUV\x00")))
+	gl.EnableVertexAttribArray(meshUVAttrib)
+	gl.VertexAttribPointer(meshUVAttrib, 2, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(3*4+3*4))
+
+	var meshIBO uint32
+	gl.GenBuffers(1, &meshIBO)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, meshIBO)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, 2*len(mesh.Indices), gl.Ptr(mesh.Indices), gl.STATIC_DRAW)
+
+	return meshVAO
+}
+
 type World struct {
 	ScreenSize g.Vec2
 	Camera     Camera
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var metricsInterval = flag.Int("metrics", 0, "print flock metrics every this many frames, 0 disables")
+
+func printMetrics(metrics *sim.Metrics) {
+	fmt.Printf("%-15s: %d\n", "frame", metrics.Frame)
+	fmt.Printf("%-15s: %.3f\n", "polarization", metrics.Polarization)
+	fmt.Printf("%-15s: %.3f\n", "milling", metrics.Milling)
+	fmt.Printf("%-15s: mean %.3f, min %.3f, isolated %d within %.2f\n", "nearest",
+		metrics.MeanNearestWithin, metrics.MinNearestWithin, metrics.Isolated, metrics.NeighborRadius)
+	fmt.Printf("%-15s: %.2f, radius %.2f\n", "extent", metrics.Extent, metrics.Radius)
+	fmt.Printf("%-15s: %.2f, velocity %.2f\n", "centroid", metrics.Centroid, metrics.Velocity)
+}
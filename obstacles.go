@@ -0,0 +1,258 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/adinfinit/g"
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var obstacleDemo = flag.Bool("obstacles", false, "add demo obstacles")
+
+// DemoObstacles is a fixed scene with one moving sphere.
+type DemoObstacles struct {
+	Moving *sim.Sphere
+}
+
+// addDemoObstacles replaces the obstacles of the flock,
+// including the ones loaded from a snapshot, with the demo scene.
+func addDemoObstacles(flock *sim.Flock) *DemoObstacles {
+	demo := &DemoObstacles{
+		Moving: &sim.Sphere{Radius: 5},
+	}
+	flock.Obstacles = nil
+	flock.AddObstacle(demo.Moving)
+	flock.AddObstacle(&sim.Box{Min: g.V3(12, -4, -4), Max: g.V3(20, 4, 4)})
+	flock.AddObstacle(&sim.Capsule{A: g.V3(-16, -12, 0), B: g.V3(-16, 12, 0), Radius: 2})
+	flock.AddObstacle(&sim.Plane{Point: g.V3(0, -35, 0), Normal: g.V3(0, 1, 0)})
+	return demo
+}
+
+func (demo *DemoObstacles) Update(time float64) {
+	sn, cs := g.Sincos(float32(time * 0.3))
+	demo.Moving.Center = g.V3(sn*10, cs*5, 0)
+}
+
+// ObstacleRenderer draws obstacles with a flat shaded program.
+//
+// Obstacles can move, so the mesh is rebuilt in world space every frame.
+type ObstacleRenderer struct {
+	Program uint32
+	VAO     uint32
+	VBO     uint32
+	IBO     uint32
+
+	projectionView int32
+	color          int32
+
+	mesh MeshData
+}
+
+const planeExtent = 100
+
+func NewObstacleRenderer() (*ObstacleRenderer, error) {
+	program, err := newProgram(obstacleVertexShader, fragmentShader, "")
+	if err != nil {
+		return nil, err
+	}
+
+	renderer := &ObstacleRenderer{Program: program}
+	renderer.projectionView = gl.GetUniformLocation(program, gl.Str("ProjectionViewMatrix\x00"))
+	renderer.color = gl.GetUniformLocation(program, gl.Str("Color\x00"))
+	gl.BindFragDataLocation(program, 0, gl.Str("OutputColor\x00"))
+
+	gl.GenVertexArrays(1, &renderer.VAO)
+	gl.BindVertexArray(renderer.VAO)
+
+	gl.GenBuffers(1, &renderer.VBO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, renderer.VBO)
+
+	positionAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexPosition\x00")))
+	gl.EnableVertexAttribArray(positionAttrib)
+	gl.VertexAttribPointer(positionAttrib, 3, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(0))
+
+	normalAttrib := uint32(gl.GetAttribLocation(program, gl.Str("VertexNormal\x00")))
+	gl.EnableVertexAttribArray(normalAttrib)
+	gl.VertexAttribPointer(normalAttrib, 3, gl.FLOAT, false, MeshVertexBytes, gl.PtrOffset(3*4))
+
+	gl.GenBuffers(1, &renderer.IBO)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, renderer.IBO)
+
+	return renderer, nil
+}
+
+func (renderer *ObstacleRenderer) Draw(obstacles []sim.Obstacle, camera *Camera) {
+	if len(obstacles) == 0 {
+		return
+	}
+
+	mesh := &renderer.mesh
+	mesh.Vertices = mesh.Vertices[:0]
+	mesh.Indices = mesh.Indices[:0]
+	for _, obstacle := range obstacles {
+		switch obstacle := obstacle.(type) {
+		case *sim.Sphere:
+			mesh.appendCapsule(obstacle.Center, obstacle.Center, obstacle.Radius)
+		case *sim.Capsule:
+			mesh.appendCapsule(obstacle.A, obstacle.B, obstacle.Radius)
+		case *sim.Box:
+			mesh.appendBox(obstacle.Min, obstacle.Max)
+		case *sim.Plane:
+			mesh.appendPlane(obstacle.Point, obstacle.Normal, planeExtent)
+		}
+	}
+	if len(mesh.Vertices) > 1<<15 {
+		log.Println("too many obstacle vertices", len(mesh.Vertices))
+		return
+	}
+
+	gl.UseProgram(renderer.Program)
+	gl.UniformMatrix4fv(renderer.projectionView, 1, false, camera.ProjectionView.Ptr())
+	gl.Uniform3f(renderer.color, 0.35, 0.4, 0.45)
+
+	gl.BindVertexArray(renderer.VAO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, renderer.VBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(mesh.Vertices)*int(MeshVertexBytes), gl.Ptr(mesh.Vertices), gl.STREAM_DRAW)
+	gl.BindBuffer(gl.ELEMENT_ARRAY_BUFFER, renderer.IBO)
+	gl.BufferData(gl.ELEMENT_ARRAY_BUFFER, 2*len(mesh.Indices), gl.Ptr(mesh.Indices), gl.STREAM_DRAW)
+
+	// planes are seen from both sides
+	gl.Disable(gl.CULL_FACE)
+	gl.DrawElements(gl.TRIANGLES, int32(len(mesh.Indices)), gl.UNSIGNED_SHORT, gl.PtrOffset(0))
+	gl.Enable(gl.CULL_FACE)
+}
+
+// appendCapsule adds a capsule from a to b, a sphere when a == b.
+func (mesh *MeshData) appendCapsule(a, b g.Vec3, radius float32) {
+	const rings, corners = 12, 16
+
+	axis := b.Sub(a)
+	length := axis.Len()
+	if length > 0 {
+		axis = axis.Mul(1 / length)
+	} else {
+		axis = g.V3(0, 1, 0)
+	}
+	u, v := orthonormalBasis(axis)
+
+	first := int16(len(mesh.Vertices))
+	for ri := 0; ri <= rings; ri++ {
+		theta := float32(ri) * g.Pi / rings
+		sn, cs := g.Sincos(theta)
+		center := a
+		if ri > rings/2 {
+			center = b
+		}
+		for pi := 0; pi <= corners; pi++ {
+			psn, pcs := g.Sincos(float32(pi) * g.Tau / corners)
+			normal := axis.Mul(-cs).Add(u.Mul(sn * pcs)).Add(v.Mul(sn * psn))
+			mesh.Vertices = append(mesh.Vertices, MeshVertex{
+				Position: center.Add(normal.Mul(radius)),
+				Normal:   normal,
+			})
+		}
+	}
+
+	for ri := 0; ri < rings; ri++ {
+		for pi := 0; pi < corners; pi++ {
+			a := first + int16(ri*(corners+1)+pi)
+			b := a + 1
+			c := a + corners + 1
+			d := c + 1
+			mesh.Triangle(a, c, d)
+			mesh.Triangle(a, d, b)
+		}
+	}
+}
+
+func (mesh *MeshData) appendBox(min, max g.Vec3) {
+	corner := func(i int) g.Vec3 {
+		p := min
+		if i&1 != 0 {
+			p.X = max.X
+		}
+		if i&2 != 0 {
+			p.Y = max.Y
+		}
+		if i&4 != 0 {
+			p.Z = max.Z
+		}
+		return p
+	}
+
+	faces := [6]struct {
+		normal  g.Vec3
+		corners [4]int
+	}{
+		{g.V3(-1, 0, 0), [4]int{0, 4, 6, 2}},
+		{g.V3(1, 0, 0), [4]int{1, 3, 7, 5}},
+		{g.V3(0, -1, 0), [4]int{0, 1, 5, 4}},
+		{g.V3(0, 1, 0), [4]int{2, 6, 7, 3}},
+		{g.V3(0, 0, -1), [4]int{0, 2, 3, 1}},
+		{g.V3(0, 0, 1), [4]int{4, 5, 7, 6}},
+	}
+	for _, face := range faces {
+		var quad [4]g.Vec3
+		for k, i := range face.corners {
+			quad[k] = corner(i)
+		}
+		mesh.appendQuad(quad, face.normal)
+	}
+}
+
+func (mesh *MeshData) appendPlane(point, normal g.Vec3, extent float32) {
+	normal = normal.Normalize()
+	u, v := orthonormalBasis(normal)
+	u, v = u.Mul(extent), v.Mul(extent)
+	mesh.appendQuad([4]g.Vec3{
+		point.Sub(u).Sub(v),
+		point.Add(u).Sub(v),
+		point.Add(u).Add(v),
+		point.Sub(u).Add(v),
+	}, normal)
+}
+
+func (mesh *MeshData) appendQuad(quad [4]g.Vec3, normal g.Vec3) {
+	first := int16(len(mesh.Vertices))
+	for _, p := range quad {
+		mesh.Vertices = append(mesh.Vertices, MeshVertex{Position: p, Normal: normal})
+	}
+	mesh.Triangle(first, first+1, first+2)
+	mesh.Triangle(first, first+2, first+3)
+}
+
+// orthonormalBasis returns two unit vectors perpendicular to axis and each other.
+func orthonormalBasis(axis g.Vec3) (u, v g.Vec3) {
+	up := g.V3(0, 1, 0)
+	if g.Abs(axis.Y) > 0.9 {
+		up = g.V3(1, 0, 0)
+	}
+	u = up.Cross(axis).Normalize()
+	v = axis.Cross(u)
+	return u, v
+}
+
+var obstacleVertexShader = `
+#version 330
+
+uniform mat4 ProjectionViewMatrix;
+uniform vec3 Color;
+
+in vec3 VertexPosition;
+in vec3 VertexNormal;
+
+out vec3 FragmentColor;
+
+const vec3 LIGHT_DIRECTION = normalize(vec3(0.3, 1, 0.5));
+
+void main() {
+	gl_Position = ProjectionViewMatrix * vec4(VertexPosition, 1);
+
+	float ambientLight = 0.3;
+	float diffuseShade = abs(dot(normalize(VertexNormal), LIGHT_DIRECTION));
+	FragmentColor = Color * (ambientLight + diffuseShade);
+}
+` + "\x00"
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"unsafe"
+
+	"github.com/adinfinit/g"
+	"github.com/go-gl/gl/v3.3-core/gl"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var predatorCount = flag.Int("predators", 0, "number of predators chasing the boids")
+
+const (
+	predatorSize  = 1.5
+	predatorBytes = int(unsafe.Sizeof(sim.Predator{}))
+)
+
+var predatorTint = g.V4(0.9, 0.25, 0.15, 1)
+
+// shark is longer and flatter than fish, with a pointy nose.
+var shark = LatheWrap(7, 4, false, func(t, phase float32) g.Vec3 {
+	r := 0.6*g.Sin(g.Pi*g.Sqrt(t)) + 0.01
+	sn, cs := g.Sincos(phase)
+	return g.V3(
+		r*sn*0.5,
+		r*cs*0.8,
+		(t-0.3)*4,
+	)
+})
+
+// PredatorRenderer draws predators as instances of the shark mesh,
+// using the predators directly as the instance data.
+type PredatorRenderer struct {
+	VAO  uint32
+	VBO  uint32
+	Mesh MeshData
+}
+
+func NewPredatorRenderer(program uint32) *PredatorRenderer {
+	renderer := &PredatorRenderer{Mesh: shark}
+	renderer.VAO = newMeshVAO(program, &renderer.Mesh)
+
+	gl.GenBuffers(1, &renderer.VBO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, renderer.VBO)
+	predatorAttrib(program, "InstancePosition", unsafe.Offsetof(sim.Predator{}.Position))
+	predatorAttrib(program, "InstanceHeading", unsafe.Offsetof(sim.Predator{}.Heading))
+
+	return renderer
+}
+
+func predatorAttrib(program uint32, name string, offset uintptr) {
+	attrib := uint32(gl.GetAttribLocation(program, gl.Str(name+"\x00")))
+	gl.EnableVertexAttribArray(attrib)
+	gl.VertexAttribPointer(attrib, 3, gl.FLOAT, false, int32(predatorBytes), gl.PtrOffset(int(offset)))
+	gl.VertexAttribDivisor(attrib, 1)
+}
+
+// Draw draws the predators, expects the boid program to be in use.
+func (renderer *PredatorRenderer) Draw(predators []sim.Predator) {
+	if len(predators) == 0 {
+		return
+	}
+
+	gl.BindVertexArray(renderer.VAO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, renderer.VBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(predators)*predatorBytes, gl.Ptr(predators), gl.STREAM_DRAW)
+
+	gl.DrawElementsInstanced(
+		gl.TRIANGLES, int32(len(renderer.Mesh.Indices)), gl.UNSIGNED_SHORT, gl.PtrOffset(0),
+		int32(len(predators)),
+	)
+}
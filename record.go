@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	recordPath   = flag.String("record", "", "record trajectories to a .csv or .ndjson file")
+	recordEvery  = flag.Int("record-every", 1, "record every n-th frame")
+	recordSample = flag.Int("record-sample", 0, "record only a random subset of n boids")
+)
+
+// startRecording attaches a recorder to the flock when requested by flags,
+// the returned func stops recording.
+func startRecording(flock *sim.Flock) (stop func() error, err error) {
+	if *recordPath == "" {
+		return func() error { return nil }, nil
+	}
+
+	format := sim.RecordCSV
+	switch filepath.Ext(*recordPath) {
+	case ".csv":
+	case ".ndjson", ".jsonl":
+		format = sim.RecordNDJSON
+	default:
+		return nil, fmt.Errorf("unknown record format %q", *recordPath)
+	}
+
+	file, err := os.Create(*recordPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create recording %q: %v", *recordPath, err)
+	}
+
+	var indices []int32
+	if *recordSample > 0 {
+		indices = sim.SampleIndices(flock.Count(), *recordSample, *seed)
+	}
+
+	recorder := sim.NewRecorder(file, format, *recordEvery, indices)
+	// the window should not stall on a slow disk, headless runs record every frame
+	recorder.Drop = !*headless
+	flock.Recorder = recorder
+
+	return func() error {
+		flock.Recorder = nil
+		err := recorder.Close()
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("unable to write recording %q: %v", *recordPath, err)
+		}
+		if recorder.Dropped > 0 {
+			log.Printf("recording %q dropped %d frames", *recordPath, recorder.Dropped)
+		}
+		return nil
+	}, nil
+}
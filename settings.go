@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	settingsPath = flag.String("settings", "", "JSON settings file, applied live when it changes")
+	settingsPoll = flag.Duration("settings-poll", time.Second, "how often to check the settings file for changes")
+)
+
+// SettingsFile is the content of the settings file,
+// fields missing from the file keep their startup values.
+type SettingsFile struct {
+	Simulation sim.Settings
+	Render     RenderSettings
+}
+
+// RenderSettings tune the boid shader.
+type RenderSettings struct {
+	SwimSpeed      float32
+	SwimRollOffset float32
+}
+
+func defaultRenderSettings() RenderSettings {
+	return RenderSettings{
+		SwimSpeed:      4,
+		SwimRollOffset: 0.7,
+	}
+}
+
+// SettingsWatcher polls the settings file for changes.
+type SettingsWatcher struct {
+	Path     string
+	Interval time.Duration
+
+	// base are the settings the file is applied on.
+	base SettingsFile
+
+	lastCheck time.Time
+	modTime   time.Time
+	size      int64
+}
+
+func NewSettingsWatcher(path string, interval time.Duration, base SettingsFile) *SettingsWatcher {
+	return &SettingsWatcher{
+		Path:     path,
+		Interval: interval,
+		base:     base,
+	}
+}
+
+// Load reads and validates the settings file.
+func (watcher *SettingsWatcher) Load() (SettingsFile, error) {
+	info, err := os.Stat(watcher.Path)
+	if err != nil {
+		return SettingsFile{}, fmt.Errorf("unable to read settings: %w", err)
+	}
+	watcher.modTime, watcher.size = info.ModTime(), info.Size()
+
+	data, err := os.ReadFile(watcher.Path)
+	if err != nil {
+		return SettingsFile{}, fmt.Errorf("unable to read settings: %w", err)
+	}
+
+	settings := watcher.base
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return SettingsFile{}, fmt.Errorf("unable to parse settings %q: %w", watcher.Path, err)
+	}
+	if err := settings.Simulation.Validate(); err != nil {
+		return SettingsFile{}, fmt.Errorf("invalid settings %q: %w", watcher.Path, err)
+	}
+	return settings, nil
+}
+
+// Poll reloads the settings file when it has changed since the last load,
+// checking at most once per Interval.
+func (watcher *SettingsWatcher) Poll(now time.Time) (settings SettingsFile, changed bool, err error) {
+	if now.Sub(watcher.lastCheck) < watcher.Interval {
+		return SettingsFile{}, false, nil
+	}
+	watcher.lastCheck = now
+
+	info, err := os.Stat(watcher.Path)
+	if err != nil {
+		return SettingsFile{}, false, fmt.Errorf("unable to check settings: %w", err)
+	}
+	if info.ModTime().Equal(watcher.modTime) && info.Size() == watcher.size {
+		return SettingsFile{}, false, nil
+	}
+
+	settings, err = watcher.Load()
+	return settings, err == nil, err
+}
+
+// startSettings loads the settings file from flags and applies it,
+// the watcher is nil when there is no settings file.
+func startSettings(flock *sim.Flock, render *RenderSettings) (*SettingsWatcher, error) {
+	if *settingsPath == "" {
+		return nil, nil
+	}
+
+	watcher := NewSettingsWatcher(*settingsPath, *settingsPoll, SettingsFile{
+		Simulation: flock.Settings,
+		Render:     *render,
+	})
+	settings, err := watcher.Load()
+	if err != nil {
+		return nil, err
+	}
+	flock.Settings, *render = settings.Simulation, settings.Render
+	return watcher, nil
+}
+
+// Update applies the settings file when it has changed.
+// Invalid settings are logged and the current settings are kept.
+func (watcher *SettingsWatcher) Update(flock *sim.Flock, render *RenderSettings) {
+	if watcher == nil {
+		return
+	}
+
+	settings, changed, err := watcher.Poll(time.Now())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if changed {
+		flock.Settings, *render = settings.Simulation, settings.Render
+		log.Println("reloaded settings", watcher.Path)
+	}
+}
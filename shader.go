@@ -86,6 +86,10 @@ uniform mat4 ProjectionViewMatrix;
 
 uniform vec3 DiffuseLightPosition;
 
+uniform float Size;
+// Tint replaces the per instance color by Tint.a.
+uniform vec4 Tint;
+
 in vec3 VertexPosition;
 in vec3 VertexNormal;
 in vec2 VertexUV;
@@ -95,9 +99,8 @@ in vec3  InstanceHeading;
 
 out vec3 FragmentColor;
 
-const float SWIM_SPEED = 4;
-const float SWIM_ROLL_OFFSET = 0.7;
-const float SIZE = 0.5;
+uniform float SwimSpeed;
+uniform float SwimRollOffset;
 
 mat4 LookAt(float size, vec3 pos, vec3 direction) {
 	vec3 up = vec3(0, 1, 0);
@@ -156,11 +159,11 @@ vec3 hsv2rgb(vec3 c)
 void main() {
 	float phase = mod(gl_InstanceID, 3.14);
 	
-	mat4 modelMatrix = LookAtOptimized(SIZE, InstancePosition, InstanceHeading);
+	mat4 modelMatrix = LookAtOptimized(Size, InstancePosition, InstanceHeading);
 	mat4 normalMatrix = transpose(inverse(ViewMatrix * modelMatrix));
 
-	float twistAmount = sin(-VertexPosition.z + phase + Time * SWIM_SPEED - SWIM_ROLL_OFFSET)*0.3;
-	float wiggleAmount = sin(Time * SWIM_SPEED - VertexPosition.z + phase) * 0.2;
+	float twistAmount = sin(-VertexPosition.z + phase + Time * SwimSpeed - SwimRollOffset)*0.3;
+	float wiggleAmount = sin(Time * SwimSpeed - VertexPosition.z + phase) * 0.2;
 	vec2 twistRotation = vec2(sin(twistAmount), cos(twistAmount));
 
 	vec3 position = Swim(VertexPosition, twistRotation, wiggleAmount);
@@ -174,7 +177,7 @@ void main() {
 	//float hue = mod(gl_InstanceID * 0.001 * sin(Time), 1);
 	if(hue < 0) hue = -hue;
 	float light = mod(gl_InstanceID * 0.035124 + Time * 0.5, 0.75) + 0.25;
-	vec3 albedo = hsv2rgb(vec3(hue, 0.4, 0.7));
+	vec3 albedo = mix(hsv2rgb(vec3(hue, 0.4, 0.7)), Tint.rgb, Tint.a);
 	float ambientLight = 0.3;
 
 	vec3 screenNormal = normalize(mat3(normalMatrix) * normal);
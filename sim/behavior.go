@@ -0,0 +1,177 @@
+package sim
+
+import "github.com/adinfinit/g"
+
+// Boid is the state of a single boid.
+type Boid struct {
+	Index    int
+	Position g.Vec3
+	Heading  g.Vec3
+	Speed    float32
+	Species  int
+}
+
+// Neighbors summarizes the boids around a boid.
+//
+// In CellAverage mode it describes the boids in the same cell,
+// in Neighborhood mode the boids within CellRadius.
+type Neighbors struct {
+	// Count is the number of boids in the neighborhood.
+	Count int
+	// Center is the average position.
+	Center g.Vec3
+	// Alignment is the average heading.
+	Alignment g.Vec3
+	// Separation points away from the neighbors.
+	Separation g.Vec3
+	// Avoid points away from neighbors of avoided species.
+	Avoid g.Vec3
+	// Target is the target the boid should fly towards.
+	Target g.Vec3
+	// TargetWeight is the weight of Target, 0 when no target is in reach.
+	TargetWeight float32
+	// Predator is the nearest predator within Settings.PanicRadius.
+	Predator g.Vec3
+	// Panic grows from 0 to 1 as the predator gets closer,
+	// it is 0 when there is no predator nearby.
+	Panic float32
+}
+
+// Behavior computes a steering direction for a boid.
+//
+// Steer is called concurrently for different boids and
+// must not modify the flock.
+type Behavior interface {
+	// Steer returns the desired direction and its weight,
+	// the direction is normalized before weighting.
+	Steer(flock *Flock, boid Boid, near Neighbors) (steer g.Vec3, weight float32)
+}
+
+// BehaviorFunc adapts a func to Behavior.
+type BehaviorFunc func(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32)
+
+func (fn BehaviorFunc) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	return fn(flock, boid, near)
+}
+
+// RegisteredBehavior is a behavior used by the flock.
+type RegisteredBehavior struct {
+	Name     string
+	Behavior Behavior
+	Enabled  bool
+}
+
+// Separation steers away from the neighbors, weighted by Settings.SeparationWeight.
+type Separation struct{}
+
+func (Separation) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	if near.Count == 0 {
+		return g.Vec3{}, 0
+	}
+	return near.Separation, flock.Settings.SeparationWeight * flock.Species[boid.Species].Separation
+}
+
+// Alignment steers towards the average heading, weighted by Settings.AlignmentWeight.
+// Panicking boids ignore the heading of others.
+type Alignment struct{}
+
+func (Alignment) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	if near.Count == 0 || near.Panic > 0 {
+		return g.Vec3{}, 0
+	}
+	return near.Alignment.Sub(boid.Heading), flock.Settings.AlignmentWeight * flock.Species[boid.Species].Alignment
+}
+
+// Cohesion steers towards the center of the neighbors, weighted by Settings.CohesionWeight.
+//
+// In CellAverage mode the separation already pulls away from the cell center,
+// so cohesion only applies in Neighborhood mode.
+type Cohesion struct{}
+
+func (Cohesion) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	if near.Count == 0 || flock.Settings.Mode == CellAverage {
+		return g.Vec3{}, 0
+	}
+	return near.Center.Sub(boid.Position), flock.Settings.CohesionWeight * flock.Species[boid.Species].Cohesion
+}
+
+// Seek steers towards the nearest target, weighted by Settings.TargetWeight
+// and the weight of the target.
+type Seek struct{}
+
+func (Seek) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	return near.Target.Sub(boid.Position), flock.Settings.TargetWeight * flock.Species[boid.Species].Target * near.TargetWeight
+}
+
+func defaultBehaviors() []RegisteredBehavior {
+	return []RegisteredBehavior{
+		{Name: "separation", Behavior: Separation{}, Enabled: true},
+		{Name: "alignment", Behavior: Alignment{}, Enabled: true},
+		{Name: "cohesion", Behavior: Cohesion{}, Enabled: true},
+		{Name: "target", Behavior: Seek{}, Enabled: true},
+		{Name: "avoidance", Behavior: Avoidance{}, Enabled: true},
+		{Name: "bounds", Behavior: Containment{}, Enabled: true},
+		{Name: "flee", Behavior: Flee{}, Enabled: true},
+		{Name: "species", Behavior: SpeciesAvoidance{}, Enabled: true},
+	}
+}
+
+// AddBehavior registers an enabled behavior,
+// replacing an existing behavior with the same name.
+//
+// Behaviors must not be modified while Step is running.
+func (flock *Flock) AddBehavior(name string, behavior Behavior) {
+	for i := range flock.Behaviors {
+		if flock.Behaviors[i].Name == name {
+			flock.Behaviors[i].Behavior = behavior
+			flock.Behaviors[i].Enabled = true
+			return
+		}
+	}
+	flock.Behaviors = append(flock.Behaviors, RegisteredBehavior{
+		Name:     name,
+		Behavior: behavior,
+		Enabled:  true,
+	})
+}
+
+// RemoveBehavior unregisters the named behavior.
+func (flock *Flock) RemoveBehavior(name string) bool {
+	for i := range flock.Behaviors {
+		if flock.Behaviors[i].Name == name {
+			flock.Behaviors = append(flock.Behaviors[:i], flock.Behaviors[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// EnableBehavior enables or disables the named behavior,
+// it returns false when there is no such behavior.
+func (flock *Flock) EnableBehavior(name string, enabled bool) bool {
+	for i := range flock.Behaviors {
+		if flock.Behaviors[i].Name == name {
+			flock.Behaviors[i].Enabled = enabled
+			return true
+		}
+	}
+	return false
+}
+
+// steer combines all enabled behaviors into a steering force,
+// its direction is the desired heading.
+func (flock *Flock) steer(boid Boid, near Neighbors) g.Vec3 {
+	total := g.Vec3{}
+	for i := range flock.Behaviors {
+		behavior := &flock.Behaviors[i]
+		if !behavior.Enabled {
+			continue
+		}
+		steer, weight := behavior.Behavior.Steer(flock, boid, near)
+		if weight == 0 {
+			continue
+		}
+		total = total.Add(safeNormalize(steer, weight))
+	}
+	return total
+}
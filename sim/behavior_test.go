@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+type constantBehavior struct{ direction g.Vec3 }
+
+func (behavior *constantBehavior) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	return behavior.direction, 1
+}
+
+func TestCustomBehavior(t *testing.T) {
+	flock := NewFlock(1000, 1)
+	defer flock.Close()
+
+	for _, name := range []string{"separation", "alignment", "cohesion", "target"} {
+		if !flock.EnableBehavior(name, false) {
+			t.Fatalf("missing behavior %q", name)
+		}
+	}
+	flock.AddBehavior("east", &constantBehavior{g.V3(1, 0, 0)})
+
+	for i := 0; i < 200; i++ {
+		flock.Step(1.0 / 30.0)
+	}
+	for i, head := range flock.Heading {
+		if head.X < 0.9 {
+			t.Fatalf("boid %d is not heading east: %v", i, head)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(10, func() { flock.Step(1.0 / 30.0) })
+	if allocs != 0 {
+		t.Errorf("got %v allocs per step", allocs)
+	}
+
+	if !flock.RemoveBehavior("east") || flock.RemoveBehavior("east") {
+		t.Errorf("remove failed")
+	}
+}
@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+var benchmarkSizes = []int{10000, 100000, 1000000}
+
+// benchmarkProcs returns the parallelism levels to benchmark.
+func benchmarkProcs() []int {
+	procs := []int{1}
+	for _, p := range []int{4, runtime.GOMAXPROCS(0)} {
+		if p > procs[len(procs)-1] {
+			procs = append(procs, p)
+		}
+	}
+	return procs
+}
+
+// benchmarkFlock runs phase on flocks of each size and parallelism,
+// after a step has prepared the grid and the cells.
+func benchmarkFlock(b *testing.B, mode Mode, phase func(flock *Flock)) {
+	for _, n := range benchmarkSizes {
+		for _, procs := range benchmarkProcs() {
+			b.Run(fmt.Sprintf("n=%d/procs=%d", n, procs), func(b *testing.B) {
+				if testing.Short() && n > 100000 {
+					b.Skip("large flock in short mode")
+				}
+				flock := NewFlock(n, 1)
+				defer flock.Close()
+				flock.Procs = procs
+				flock.Settings.Mode = mode
+				flock.Step(1.0 / 60.0)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					phase(flock)
+				}
+				b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N)/float64(n), "ns/boid")
+			})
+		}
+	}
+}
+
+// benchmarkModes runs benchmarkFlock for each mode.
+func benchmarkModes(b *testing.B, phase func(flock *Flock)) {
+	for _, mode := range []Mode{CellAverage, Neighborhood} {
+		b.Run(mode.String(), func(b *testing.B) {
+			benchmarkFlock(b, mode, phase)
+		})
+	}
+}
+
+func BenchmarkHashPositions(b *testing.B) {
+	benchmarkFlock(b, CellAverage, func(flock *Flock) { flock.hashPositions(flock.radius) })
+}
+
+func BenchmarkResizeCells(b *testing.B) {
+	benchmarkFlock(b, CellAverage, func(flock *Flock) { flock.resizeCells() })
+}
+
+func BenchmarkComputeCells(b *testing.B) {
+	benchmarkFlock(b, CellAverage, func(flock *Flock) { flock.computeCells() })
+}
+
+func BenchmarkSteerAndMove(b *testing.B) {
+	benchmarkModes(b, func(flock *Flock) { flock.steerAndMove(1.0 / 60.0) })
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkModes(b, func(flock *Flock) { flock.Step(1.0 / 60.0) })
+}
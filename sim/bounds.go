@@ -0,0 +1,196 @@
+package sim
+
+import "github.com/adinfinit/g"
+
+// BoundsMode selects what happens to boids leaving the bounds.
+type BoundsMode int32
+
+const (
+	// Unbounded lets boids fly anywhere.
+	Unbounded BoundsMode = iota
+	// Wrap moves boids leaving the bounds to the opposite side.
+	// With BoxBounds, Neighborhood mode also finds neighbors across the sides.
+	Wrap
+	// Bounce reflects boids off the bounds.
+	Bounce
+	// Soft steers boids back inside, weighted by Settings.BoundsWeight.
+	Soft
+)
+
+func (mode BoundsMode) String() string {
+	switch mode {
+	case Unbounded:
+		return "unbounded"
+	case Wrap:
+		return "wrap"
+	case Bounce:
+		return "bounce"
+	case Soft:
+		return "soft"
+	default:
+		return "unknown"
+	}
+}
+
+// BoundsShape is the shape of the bounds centered at the origin.
+type BoundsShape int32
+
+const (
+	// BoxBounds is a cube with half side Settings.BoundsSize.
+	BoxBounds BoundsShape = iota
+	// SphereBounds is a sphere with radius Settings.BoundsSize.
+	SphereBounds
+)
+
+func (shape BoundsShape) String() string {
+	switch shape {
+	case BoxBounds:
+		return "box"
+	case SphereBounds:
+		return "sphere"
+	default:
+		return "unknown"
+	}
+}
+
+// confine applies Wrap and Bounce to a boid that has moved.
+func (flock *Flock) confine(pos, head g.Vec3) (g.Vec3, g.Vec3) {
+	size := flock.Settings.BoundsSize
+	if size <= 0 {
+		return pos, head
+	}
+
+	switch flock.Settings.Bounds {
+	case Wrap:
+		if flock.Settings.BoundsShape == SphereBounds {
+			if length := pos.Len(); length > size {
+				// reenter from the opposite side
+				depth := g.Clamp(2*size-length, 0, size)
+				pos = pos.Mul(-depth / length)
+			}
+			return pos, head
+		}
+		pos.X = wrap(pos.X, size)
+		pos.Y = wrap(pos.Y, size)
+		pos.Z = wrap(pos.Z, size)
+
+	case Bounce:
+		if flock.Settings.BoundsShape == SphereBounds {
+			if length := pos.Len(); length > size {
+				normal := pos.Mul(1 / length)
+				pos = normal.Mul(g.Max(2*size-length, 0))
+				if along := head.Dot(normal); along > 0 {
+					head = head.Sub(normal.Mul(2 * along))
+				}
+			}
+			return pos, head
+		}
+		pos.X, head.X = bounce(pos.X, head.X, size)
+		pos.Y, head.Y = bounce(pos.Y, head.Y, size)
+		pos.Z, head.Z = bounce(pos.Z, head.Z, size)
+	}
+
+	return pos, head
+}
+
+// wrap wraps v into [-size, size).
+func wrap(v, size float32) float32 {
+	if v >= -size && v < size {
+		return v
+	}
+	return v - 2*size*float32(floor32((v+size)/(2*size)))
+}
+
+// bounce reflects v and heading h off [-size, size].
+func bounce(v, h, size float32) (float32, float32) {
+	switch {
+	case v > size:
+		return g.Max(2*size-v, -size), -g.Abs(h)
+	case v < -size:
+		return g.Min(-2*size-v, size), g.Abs(h)
+	}
+	return v, h
+}
+
+// periodic returns whether neighbors are looked up across the sides of the bounds.
+//
+// Images of the neighborhood must not overlap,
+// so the bounds must be large compared to the radius.
+func (flock *Flock) periodic(radius float32) bool {
+	settings := &flock.Settings
+	return settings.Bounds == Wrap && settings.BoundsShape == BoxBounds &&
+		settings.BoundsSize > 2*radius
+}
+
+// wrapShift returns the offset to the periodic image of pos on each axis,
+// zero when pos is further than radius from that side.
+func (flock *Flock) wrapShift(pos g.Vec3, radius float32) g.Vec3 {
+	size := flock.Settings.BoundsSize
+	shift := func(v float32) float32 {
+		switch {
+		case v < -size+radius:
+			return 2 * size
+		case v > size-radius:
+			return -2 * size
+		}
+		return 0
+	}
+	return g.V3(shift(pos.X), shift(pos.Y), shift(pos.Z))
+}
+
+// hollowSphere is the inside of a sphere as an obstacle.
+type hollowSphere struct{ radius float32 }
+
+func (sphere *hollowSphere) Distance(p g.Vec3) (float32, g.Vec3) {
+	return sphere.radius - p.Len(), safeNormalize(p, -1)
+}
+
+// walls are the Soft bounds as obstacles.
+type walls struct {
+	box    [6]Plane
+	sphere hollowSphere
+}
+
+func (walls *walls) update(settings *Settings) {
+	size := settings.BoundsSize
+	walls.sphere.radius = size
+	for axis := 0; axis < 3; axis++ {
+		var normal g.Vec3
+		switch axis {
+		case 0:
+			normal.X = 1
+		case 1:
+			normal.Y = 1
+		case 2:
+			normal.Z = 1
+		}
+		walls.box[2*axis] = Plane{Point: normal.Mul(-size), Normal: normal}
+		walls.box[2*axis+1] = Plane{Point: normal.Mul(size), Normal: normal.Neg()}
+	}
+}
+
+// Containment steers boids back inside Soft bounds,
+// weighted by Settings.BoundsWeight.
+type Containment struct{}
+
+func (Containment) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	settings := &flock.Settings
+	distance := settings.AvoidanceDistance
+	if settings.Bounds != Soft || settings.BoundsSize <= 0 || distance <= 0 {
+		return g.Vec3{}, 0
+	}
+
+	if settings.BoundsShape == SphereBounds {
+		steer, urgency := avoid(&flock.walls.sphere, boid, distance)
+		return sideways(steer, boid.Heading), settings.BoundsWeight * urgency
+	}
+
+	steer := g.Vec3{}
+	urgency := float32(0)
+	for i := range flock.walls.box {
+		s, u := avoid(&flock.walls.box[i], boid, distance)
+		steer = steer.Add(s)
+		urgency = g.Max(urgency, u)
+	}
+	return sideways(steer, boid.Heading), settings.BoundsWeight * urgency
+}
@@ -0,0 +1,83 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestBounds(t *testing.T) {
+	for _, mode := range []BoundsMode{Wrap, Bounce, Soft} {
+		for _, shape := range []BoundsShape{BoxBounds, SphereBounds} {
+			t.Run(mode.String()+"-"+shape.String(), func(t *testing.T) {
+				flock := NewFlock(1000, 1)
+				defer flock.Close()
+
+				flock.EnableBehavior("target", false)
+				flock.AddBehavior("east", &constantBehavior{g.V3(1, 0.3, 0)})
+				flock.Settings.Mode = Neighborhood
+				flock.Settings.Bounds = mode
+				flock.Settings.BoundsShape = shape
+				flock.Settings.BoundsSize = 25
+
+				// soft bounds only steer, so boids overshoot while turning
+				limit := flock.Settings.BoundsSize * 1.001
+				if mode == Soft {
+					limit = flock.Settings.BoundsSize * 1.5
+				}
+
+				for i := 0; i < 300; i++ {
+					flock.Step(1.0 / 30.0)
+				}
+				for i, pos := range flock.Position {
+					distance := pos.Len()
+					if shape == BoxBounds {
+						distance = g.Max(g.Abs(pos.X), g.Max(g.Abs(pos.Y), g.Abs(pos.Z)))
+					}
+					if distance > limit {
+						t.Fatalf("boid %d is outside: %v", i, pos)
+					}
+				}
+
+				allocs := testing.AllocsPerRun(10, func() { flock.Step(1.0 / 30.0) })
+				if allocs != 0 {
+					t.Errorf("got %v allocs per step", allocs)
+				}
+			})
+		}
+	}
+}
+
+type neighborCount struct{ count []int }
+
+func (behavior *neighborCount) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	behavior.count[boid.Index] = near.Count
+	return g.Vec3{}, 0
+}
+
+func TestWrapNeighbors(t *testing.T) {
+	for _, bounds := range []BoundsMode{Unbounded, Wrap} {
+		flock := NewFlock(2, 1)
+		defer flock.Close()
+
+		counter := &neighborCount{count: make([]int, 2)}
+		flock.AddBehavior("count", counter)
+		flock.Settings.Mode = Neighborhood
+		flock.Settings.Bounds = bounds
+		flock.Settings.BoundsSize = 40
+		flock.Position[0] = g.V3(-39.5, 39.5, 0)
+		flock.Position[1] = g.V3(39.5, -39.5, 0)
+
+		flock.Step(1.0 / 30.0)
+
+		expected := 0
+		if bounds == Wrap {
+			expected = 1
+		}
+		for i, count := range counter.count {
+			if count != expected {
+				t.Errorf("%v: boid %d has %d neighbors, expected %d", bounds, i, count, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package sim
+
+import (
+	"cmp"
+
+	"github.com/adinfinit/g"
+)
+
+// Cell is the integer coordinate of a grid cell.
+type Cell struct{ X, Y, Z int32 }
+
+// cellOf returns the cell containing p, cells are 1/invradius wide.
+func cellOf(p g.Vec3, invradius float32) Cell {
+	return Cell{
+		X: floor32(p.X * invradius),
+		Y: floor32(p.Y * invradius),
+		Z: floor32(p.Z * invradius),
+	}
+}
+
+func (cell Cell) Offset(dx, dy, dz int32) Cell {
+	return Cell{cell.X + dx, cell.Y + dy, cell.Z + dz}
+}
+
+// floor32 rounds towards negative infinity,
+// unlike the int32 conversion which truncates towards zero.
+func floor32(v float32) int32 {
+	i := int32(v)
+	if float32(i) > v {
+		i--
+	}
+	return i
+}
+
+func (cell Cell) Min(other Cell) Cell {
+	return Cell{min(cell.X, other.X), min(cell.Y, other.Y), min(cell.Z, other.Z)}
+}
+
+func (cell Cell) Max(other Cell) Cell {
+	return Cell{max(cell.X, other.X), max(cell.Y, other.Y), max(cell.Z, other.Z)}
+}
+
+// compareCell orders cells by Z, Y and then X.
+func compareCell(a, b Cell) int {
+	switch {
+	case a.Z != b.Z:
+		return cmp.Compare(a.Z, b.Z)
+	case a.Y != b.Y:
+		return cmp.Compare(a.Y, b.Y)
+	default:
+		return cmp.Compare(a.X, b.X)
+	}
+}
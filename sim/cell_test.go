@@ -0,0 +1,77 @@
+package sim
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestFloor32(t *testing.T) {
+	tests := []struct {
+		in  float32
+		out int32
+	}{
+		{0, 0}, {0.5, 0}, {1, 1}, {-0.5, -1}, {-1, -1}, {-1.5, -2}, {2.75, 2},
+	}
+	for _, test := range tests {
+		if got := floor32(test.in); got != test.out {
+			t.Errorf("floor32(%v) = %v, expected %v", test.in, got, test.out)
+		}
+	}
+}
+
+func TestCellIndexUnique(t *testing.T) {
+	// spread 200 is too large for a dense grid
+	for _, spread := range []float32{20, 200} {
+		testCellIndexUnique(t, spread)
+	}
+}
+
+func testCellIndexUnique(t *testing.T, spread float32) {
+	const radius = 0.75
+
+	flock := NewFlock(20000, 1)
+	defer flock.Close()
+	rng := rand.New(rand.NewSource(1))
+	for i := range flock.Position {
+		flock.Position[i] = g.V3(
+			(rng.Float32()-0.5)*spread,
+			(rng.Float32()-0.5)*spread,
+			(rng.Float32()-0.5)*spread,
+		)
+	}
+	// boids straddling the origin must land in different cells
+	flock.Position[0] = g.V3(-0.5, 0.1, 0.1)
+	flock.Position[1] = g.V3(0.5, 0.1, 0.1)
+
+	flock.hashPositions(radius)
+	flock.resizeCells()
+	flock.computeCells()
+
+	if flock.CellIndex[0] == flock.CellIndex[1] {
+		t.Errorf("boids across the origin share a cell")
+	}
+
+	cellByIndex := map[int32]Cell{}
+	indexByCell := map[Cell]int32{}
+	for i, p := range flock.Position {
+		cell := cellOf(p, 1/radius)
+		index := flock.CellIndex[i]
+
+		if other, ok := cellByIndex[index]; ok && other != cell {
+			t.Fatalf("cells %v and %v share index %d", cell, other, index)
+		}
+		if other, ok := indexByCell[cell]; ok && other != index {
+			t.Fatalf("cell %v has indices %d and %d", cell, index, other)
+		}
+		cellByIndex[index] = cell
+		indexByCell[cell] = index
+
+		min := g.V3(float32(cell.X), float32(cell.Y), float32(cell.Z)).Mul(radius)
+		max := min.Add(g.V3(radius, radius, radius))
+		if !p.Ge(min) || !p.Lt(max) {
+			t.Errorf("boid %v outside of its cell %v", p, cell)
+		}
+	}
+}
@@ -0,0 +1,508 @@
+// Package sim implements the flocking simulation without any rendering.
+package sim
+
+import (
+	"math/rand"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/adinfinit/g"
+	"github.com/loov/hrtime"
+)
+
+const (
+	DefaultCount = 1000000
+)
+
+type Settings struct {
+	Mode Mode
+
+	CellRadius float32
+	// CellRadiusWobble makes CellRadius oscillate over time by this amount.
+	CellRadiusWobble float32
+	// MaxNeighbors limits the neighbors considered in Neighborhood mode,
+	// 0 means unlimited.
+	MaxNeighbors int32
+
+	SeparationWeight float32
+	AlignmentWeight  float32
+	CohesionWeight   float32
+	TargetWeight     float32
+	// TargetBlend is the number of nearest targets blended together,
+	// 0 and 1 use only the nearest target.
+	TargetBlend int32
+
+	AvoidanceWeight float32
+	// AvoidanceDistance is how far ahead boids look for obstacles and bounds.
+	AvoidanceDistance float32
+
+	// Bounds keeps boids within BoundsSize of the origin.
+	Bounds       BoundsMode
+	BoundsShape  BoundsShape
+	BoundsSize   float32
+	BoundsWeight float32
+
+	// PanicRadius is how close a predator must be for boids to flee.
+	PanicRadius   float32
+	FleeWeight    float32
+	PredatorSpeed float32
+	// PredatorSight is how far predators look for prey.
+	PredatorSight float32
+
+	// Boids keep their speed within MinSpeed and MaxSpeed, 0 MaxSpeed is unlimited,
+	// and within the speed range of their species.
+	MinSpeed float32
+	MaxSpeed float32
+	// MaxAcceleration limits the change of speed,
+	// 0 keeps the speed of each boid constant.
+	MaxAcceleration float32
+	// MaxTurnRate limits turning in radians per second, 0 is unlimited.
+	MaxTurnRate float32
+	// Drag slows down boids proportionally to their speed.
+	Drag float32
+
+	// Integrator moves the boids.
+	Integrator Integrator
+	// MaxStep splits longer steps into substeps, 0 never splits.
+	// Boids and predators move in substeps, but the neighbors, cells
+	// and the prey of predators are found once at the start of the step.
+	MaxStep float32
+	// MaxSubsteps limits the substeps of a single step.
+	MaxSubsteps int32
+
+	// SpeciesAvoidWeight weights steering away from avoided species.
+	SpeciesAvoidWeight float32
+}
+
+// Timing contains the duration of each phase of the last Step.
+type Timing struct {
+	HashPositions time.Duration
+	ResizeCells   time.Duration
+	ComputeCells  time.Duration
+	SteerAndMove  time.Duration
+	Total         time.Duration
+}
+
+// Add accumulates other into timing.
+func (timing *Timing) Add(other *Timing) {
+	timing.HashPositions += other.HashPositions
+	timing.ResizeCells += other.ResizeCells
+	timing.ComputeCells += other.ComputeCells
+	timing.SteerAndMove += other.SteerAndMove
+	timing.Total += other.Total
+}
+
+// Div returns timing with each phase divided by n.
+func (timing Timing) Div(n int) Timing {
+	if n <= 0 {
+		return timing
+	}
+	d := time.Duration(n)
+	return Timing{
+		HashPositions: timing.HashPositions / d,
+		ResizeCells:   timing.ResizeCells / d,
+		ComputeCells:  timing.ComputeCells / d,
+		SteerAndMove:  timing.SteerAndMove / d,
+		Total:         timing.Total / d,
+	}
+}
+
+type Flock struct {
+	Settings Settings
+
+	Position  []g.Vec3
+	Heading   []g.Vec3
+	Speed     []float32
+	CellIndex []int32
+	// SpeciesIndex is the species of each boid.
+	SpeciesIndex []uint8
+
+	// Species are the kinds of boids in the flock, there is at least one.
+	Species      []Species
+	speciesStart []int
+	interactions []Interaction
+
+	// Targets attract the boids, they can be changed between steps.
+	Targets []Target
+
+	// Behaviors are combined to steer the boids.
+	Behaviors []RegisteredBehavior
+	// Obstacles are avoided by the Avoidance behavior,
+	// they can be moved between steps.
+	Obstacles []Obstacle
+	// Predators chase the boids.
+	Predators []Predator
+	// Fields move the boids along with them, they can be changed between steps.
+	Fields []Field
+	// Timeline animates the settings and targets, see SetTimeline.
+	Timeline *Timeline
+	// TimelineError is the first error of animating the Timeline in Step,
+	// such as a removed target or settings that do not validate.
+	TimelineError error
+	// OnTimelineError is called when TimelineError is set.
+	OnTimelineError func(flock *Flock, err error)
+
+	// bound is the timeline whose tracks are in boundTracks.
+	bound       *Timeline
+	boundTracks []boundTrack
+	// animated are the settings being animated by the timeline.
+	animated Settings
+
+	rng *rand.Rand
+	// source is the state of rng, it is saved in snapshots.
+	source splitMix
+
+	// Procs is the number of goroutines used for simulation.
+	Procs int
+
+	Frame  int
+	Time   float64
+	Timing Timing
+
+	// Recorder, when set, is called after each Step.
+	Recorder *Recorder
+	// Health, when set, checks the flock after each phase of Step.
+	Health *Health
+
+	// MetricsInterval computes LastMetrics every this many frames, 0 disables.
+	MetricsInterval int
+	LastMetrics     Metrics
+
+	Grid           Grid
+	CellTarget     []g.Vec3
+	CellAlignment  []g.Vec3
+	CellSeparation []g.Vec3
+	// CellTargetWeight is the weight of CellTarget, 0 when no target is in reach.
+	CellTargetWeight []float32
+	// CellSpecies contains the averages of each species in each cell,
+	// indexed by cell*len(Species) + species. It is only computed
+	// when there are several species.
+	CellSpecies []SpeciesCell
+
+	nextPosition []g.Vec3
+	nextHeading  []g.Vec3
+	// candidates are the neighbors of a boid per thread, see sumNearest.
+	candidates [][]candidate
+
+	metricsParts    []metricsPart
+	metricsGrid     Grid
+	metricsCentroid g.Vec3
+	metricsRadius   float32
+
+	pool *pool
+	// dt is the duration of a substep.
+	dt       float32
+	substeps int
+	// radius is the cell radius of the current step.
+	radius float32
+	// maxTurnCos and maxTurnSin describe the largest rotation of a step.
+	maxTurnCos float32
+	maxTurnSin float32
+	// walls are the Soft bounds for the current step.
+	walls walls
+}
+
+// NewFlock creates a flock of count randomly placed boids.
+// Flocks with the same seed and settings evolve identically
+// when stepped with the same time steps.
+//
+// The flock starts worker goroutines, Close must be called
+// when it is no longer used.
+func NewFlock(count int, seed int64) *Flock {
+	flock := &Flock{}
+	flock.source.Seed(seed)
+	flock.rng = rand.New(&flock.source)
+	flock.initData()
+	flock.Resize(count)
+	return flock
+}
+
+// Resize grows or shrinks the flock to count boids,
+// new boids are placed randomly.
+//
+// With several species, each species keeps its share of the flock.
+func (flock *Flock) Resize(count int) {
+	if count < 0 {
+		count = 0
+	}
+
+	previous := flock.Count()
+	last := len(flock.Species) - 1
+	remaining := count
+	for k := 0; k < last; k++ {
+		start, limit := flock.SpeciesRange(k)
+		n := count / len(flock.Species)
+		if previous > 0 {
+			n = int(int64(count) * int64(limit-start) / int64(previous))
+		}
+		flock.ResizeSpecies(k, n)
+		remaining -= n
+	}
+	flock.ResizeSpecies(last, remaining)
+}
+
+func (flock *Flock) randomize(start, limit int) {
+	for i := start; i < limit; i++ {
+		species := flock.species(i)
+		flock.Position[i] = g.V3(
+			flock.rng.Float32()*40-20,
+			flock.rng.Float32()*40-20,
+			flock.rng.Float32()*40-20,
+		)
+		flock.Heading[i] = g.V3(
+			flock.rng.Float32()-0.5,
+			flock.rng.Float32()-0.5,
+			flock.rng.Float32()-0.5,
+		).Normalize()
+		flock.Speed[i] = species.MinSpeed + flock.rng.Float32()*(species.MaxSpeed-species.MinSpeed)
+	}
+}
+
+func (flock *Flock) initData() {
+	flock.Settings.CellRadius = 5
+	flock.Settings.CellRadiusWobble = 2
+	flock.Settings.SeparationWeight = 0.5
+	flock.Settings.AlignmentWeight = 1
+	flock.Settings.CohesionWeight = 0.5
+	flock.Settings.TargetWeight = 1
+	flock.Settings.AvoidanceWeight = 4
+	flock.Settings.AvoidanceDistance = 5
+	flock.Settings.BoundsSize = 40
+	flock.Settings.BoundsWeight = 4
+	flock.Settings.PanicRadius = 10
+	flock.Settings.FleeWeight = 6
+	flock.Settings.PredatorSpeed = 10
+	flock.Settings.PredatorSight = 20
+	flock.Settings.SpeciesAvoidWeight = 2
+	flock.Settings.MinSpeed = 3
+	flock.Settings.MaxSpeed = 12
+	flock.Settings.MaxAcceleration = 5
+	flock.Settings.MaxTurnRate = 3
+	flock.Settings.Drag = 0.15
+	flock.Settings.Integrator = SemiImplicitEuler
+	flock.Settings.MaxStep = 1.0 / 30
+	flock.Settings.MaxSubsteps = 8
+
+	flock.Species = []Species{DefaultSpecies()}
+	flock.speciesStart = []int{0, 0}
+	flock.interactions = []Interaction{Flocking}
+
+	flock.Targets = defaultTargets()
+	flock.Behaviors = defaultBehaviors()
+
+	flock.Procs = runtime.GOMAXPROCS(-1)
+	flock.pool = &pool{}
+	flock.Grid.pool = flock.pool
+	flock.metricsGrid.pool = flock.pool
+}
+
+func (flock *Flock) Count() int { return len(flock.Position) }
+
+type stopwatch struct {
+	start time.Duration
+	into  *time.Duration
+}
+
+func measure(into *time.Duration) stopwatch {
+	return stopwatch{start: hrtime.Now(), into: into}
+}
+
+func (watch stopwatch) stop() { *watch.into = hrtime.Since(watch.start) }
+
+// Close stops the goroutines used for simulation.
+func (flock *Flock) Close() { flock.pool.close() }
+
+// Step advances the simulation by dt seconds.
+func (flock *Flock) Step(dt float32) {
+	flock.Frame++
+	flock.Time += float64(dt)
+
+	if flock.Timeline != nil {
+		if err := flock.animate(flock.Timeline); err != nil && flock.TimelineError == nil {
+			flock.TimelineError = err
+			if flock.OnTimelineError != nil {
+				flock.OnTimelineError(flock, err)
+			}
+		}
+	}
+	flock.moveTargets()
+	flock.radius = flock.Settings.CellRadius + flock.Settings.CellRadiusWobble*g.Sin(float32(flock.Time))
+
+	defer measure(&flock.Timing.Total).stop()
+	flock.checkHealth("start")
+	flock.hashPositions(flock.radius)
+	flock.resizeCells()
+	flock.computeCells()
+	flock.checkHealth("computeCells")
+	flock.chase(dt)
+	flock.checkHealth("chase")
+	flock.steerAndMove(dt)
+	flock.checkHealth("steerAndMove")
+
+	if flock.MetricsInterval > 0 && flock.Frame%flock.MetricsInterval == 0 {
+		flock.LastMetrics = flock.Metrics()
+	}
+
+	if flock.Recorder != nil {
+		flock.Recorder.Record(flock)
+	}
+}
+
+func (flock *Flock) hashPositions(radius float32) {
+	defer measure(&flock.Timing.HashPositions).stop()
+
+	flock.Grid.Build(flock.Position, radius, flock.Procs)
+}
+
+func (flock *Flock) resizeCells() {
+	defer measure(&flock.Timing.ResizeCells).stop()
+
+	cellCount := len(flock.Grid.Cells)
+
+	flock.CellAlignment = resize(flock.CellAlignment, cellCount)
+	flock.CellSeparation = resize(flock.CellSeparation, cellCount)
+	flock.CellTarget = resize(flock.CellTarget, cellCount)
+	flock.CellTargetWeight = resize(flock.CellTargetWeight, cellCount)
+	if len(flock.Species) > 1 {
+		flock.CellSpecies = resize(flock.CellSpecies, cellCount*len(flock.Species))
+	}
+}
+
+func (flock *Flock) computeCells() {
+	defer measure(&flock.Timing.ComputeCells).stop()
+
+	flock.pool.run(flock.Procs, flock, phaseComputeCells)
+}
+
+// cellRange returns the cells handled by thread tid,
+// the cells are split so that each thread gets a similar number of boids.
+func (flock *Flock) cellRange(tid, threads int) (start, limit int) {
+	grid := &flock.Grid
+	cells := grid.Start[:len(grid.Cells)]
+	first, last := blockRange(flock.Count(), threads, tid)
+	start, _ = slices.BinarySearch(cells, int32(first))
+	limit, _ = slices.BinarySearch(cells, int32(last))
+	return start, limit
+}
+
+func (flock *Flock) computeCellRange(start, limit int) {
+	grid := &flock.Grid
+	for cellIndex := start; cellIndex < limit; cellIndex++ {
+		indices := grid.Index[grid.Start[cellIndex]:grid.Start[cellIndex+1]]
+
+		alignment := g.Vec3{}
+		separation := g.Vec3{}
+
+		for _, boidIndex := range indices {
+			flock.CellIndex[boidIndex] = int32(cellIndex)
+			alignment = alignment.Add(flock.Heading[boidIndex])
+			separation = separation.Add(flock.Position[boidIndex])
+		}
+
+		byCount := 1.0 / float32(len(indices))
+		center := separation.Mul(byCount)
+		flock.CellAlignment[cellIndex] = alignment.Mul(byCount)
+		flock.CellSeparation[cellIndex] = center
+
+		flock.CellTarget[cellIndex], flock.CellTargetWeight[cellIndex] = flock.blendTargets(center)
+
+		if len(flock.Species) > 1 {
+			flock.computeSpeciesCell(cellIndex, indices)
+		}
+	}
+}
+
+// computeSpeciesCell computes the averages of each species in a cell.
+func (flock *Flock) computeSpeciesCell(cellIndex int, indices []int32) {
+	n := len(flock.Species)
+	cells := flock.CellSpecies[cellIndex*n : (cellIndex+1)*n]
+	clear(cells)
+
+	for _, boidIndex := range indices {
+		cell := &cells[flock.SpeciesIndex[boidIndex]]
+		cell.Count++
+		cell.Alignment = cell.Alignment.Add(flock.Heading[boidIndex])
+		cell.Center = cell.Center.Add(flock.Position[boidIndex])
+	}
+
+	for k := range cells {
+		cell := &cells[k]
+		if cell.Count > 0 {
+			byCount := 1 / float32(cell.Count)
+			cell.Alignment = cell.Alignment.Mul(byCount)
+			cell.Center = cell.Center.Mul(byCount)
+		}
+	}
+}
+
+func (flock *Flock) steerAndMove(dt float32) {
+	defer measure(&flock.Timing.SteerAndMove).stop()
+
+	flock.updateSubsteps(dt)
+	flock.updateTurnLimit()
+	flock.walls.update(&flock.Settings)
+	if flock.Settings.Mode == Neighborhood {
+		flock.steerNeighborhood()
+		return
+	}
+
+	flock.pool.run(flock.Procs, flock, phaseSteerAndMove)
+}
+
+func (flock *Flock) steerAndMoveRange(start, limit int) {
+	for i := start; i < limit; i++ {
+		cell := flock.CellIndex[i]
+		pos := flock.Position[i]
+		head := flock.Heading[i]
+
+		boid := Boid{Index: i, Position: pos, Heading: head, Speed: flock.Speed[i], Species: int(flock.SpeciesIndex[i])}
+		var near Neighbors
+		if len(flock.Species) > 1 {
+			near = flock.speciesNeighbors(cell, boid)
+		} else {
+			near = Neighbors{
+				Count:        int(flock.Grid.Start[cell+1] - flock.Grid.Start[cell]),
+				Center:       flock.CellSeparation[cell],
+				Alignment:    flock.CellAlignment[cell],
+				Separation:   pos.Sub(flock.CellSeparation[cell]),
+				Target:       flock.CellTarget[cell],
+				TargetWeight: flock.CellTargetWeight[cell],
+			}
+		}
+		near.Predator, near.Panic = flock.threat(pos)
+
+		boid = flock.integrate(boid, near)
+		flock.Position[i], flock.Heading[i], flock.Speed[i] = boid.Position, boid.Heading, boid.Speed
+	}
+}
+
+const (
+	phaseComputeCells = iota
+	phaseSteerAndMove
+	phaseSteerNeighborhood
+	phaseMove
+	phaseMetricsSums
+	phaseMetricsSpread
+)
+
+func (flock *Flock) runTask(phase, tid, threads int) {
+	if phase == phaseComputeCells {
+		flock.computeCellRange(flock.cellRange(tid, threads))
+		return
+	}
+
+	start, limit := blockRange(flock.Count(), threads, tid)
+	switch phase {
+	case phaseSteerAndMove:
+		flock.steerAndMoveRange(start, limit)
+	case phaseSteerNeighborhood:
+		flock.steerNeighborhoodRange(tid, start, limit)
+	case phaseMove:
+		flock.moveRange(start, limit)
+	case phaseMetricsSums:
+		flock.sumMetricsRange(tid, start, limit)
+	case phaseMetricsSpread:
+		flock.spreadMetricsRange(tid, start, limit)
+	}
+}
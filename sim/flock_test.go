@@ -0,0 +1,196 @@
+package sim
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestDeterministic(t *testing.T) {
+	const count, steps = 5000, 50
+
+	run := func(mode Mode, procs int) *Flock {
+		flock := NewFlock(count, 42)
+		flock.Settings.Mode = mode
+		flock.Procs = procs
+		for i := 0; i < steps; i++ {
+			flock.Step(1.0 / 60.0)
+		}
+		return flock
+	}
+
+	for _, mode := range []Mode{CellAverage, Neighborhood} {
+		a, b := run(mode, 1), run(mode, 7)
+		defer a.Close()
+		defer b.Close()
+		for i := range a.Position {
+			if a.Position[i] != b.Position[i] || a.Heading[i] != b.Heading[i] {
+				t.Fatalf("%v: boid %d differs: %v %v != %v %v", mode, i,
+					a.Position[i], a.Heading[i], b.Position[i], b.Heading[i])
+			}
+		}
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		flock := NewFlock(1000, 1)
+		defer flock.Close()
+		flock.SpawnPredators(2)
+		shark, _ := flock.AddSpecies(Species{Name: "shark", Separation: 2, MinSpeed: 8, MaxSpeed: 9, Size: 1}, 100)
+		flock.SetInteraction(0, shark, Avoid)
+		flock.AddTarget(Target{Weight: 2, Radius: 30, Path: &Spline{
+			Points:   []g.Vec3{g.V3(10, 0, 0), g.V3(0, 10, 0), g.V3(-10, 0, 0)},
+			Duration: 5,
+		}})
+		obstacles := []Obstacle{
+			&Sphere{Center: g.V3(1, 2, 3), Radius: 4},
+			&Box{Min: g.V3(-1, -1, -1), Max: g.V3(1, 2, 3)},
+			&Plane{Point: g.V3(0, -30, 0), Normal: g.V3(0, 1, 0)},
+			&Capsule{A: g.V3(-5, 0, 0), B: g.V3(5, 0, 0), Radius: 1},
+		}
+		for _, obstacle := range obstacles {
+			flock.AddObstacle(obstacle)
+		}
+		fields := []Field{
+			&Wind{Velocity: g.V3(1, 0, 0), Gust: g.V3(0, 1, 0), Frequency: 2},
+			&Vortex{Axis: g.V3(0, 1, 0), Radius: 10, Strength: 2},
+			&CurlNoise{Scale: 20, Strength: 1, Speed: 0.1, Seed: 7},
+			&VectorGrid{Spacing: 2, Size: [3]int{2, 1, 1}, Velocities: []g.Vec3{g.V3(1, 0, 0), g.V3(0, 0, 1)}},
+		}
+		for _, field := range fields {
+			flock.AddField(field)
+		}
+		flock.EnableBehavior("cohesion", false)
+		flock.Step(1.0 / 60.0)
+
+		var buf bytes.Buffer
+		var err error
+		if compress {
+			err = flock.SaveCompressed(&buf)
+		} else {
+			err = flock.Save(&buf)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+
+		loaded := NewFlock(10, 2)
+		defer loaded.Close()
+		if err := loaded.Load(bytes.NewReader(data)); err != nil {
+			t.Fatal(err)
+		}
+
+		if loaded.Count() != flock.Count() || loaded.Time != flock.Time || loaded.Settings != flock.Settings ||
+			!slices.Equal(loaded.Predators, flock.Predators) || !slices.Equal(loaded.Species, flock.Species) ||
+			!slices.Equal(loaded.SpeciesIndex, flock.SpeciesIndex) || loaded.Interaction(0, shark) != Avoid ||
+			len(loaded.Targets) != len(flock.Targets) {
+			t.Fatalf("mismatch after load")
+		}
+		if !reflect.DeepEqual(loaded.Obstacles, obstacles) || !reflect.DeepEqual(loaded.Fields, fields) {
+			t.Fatalf("obstacles or fields differ after load")
+		}
+		for k, behavior := range loaded.Behaviors {
+			if behavior.Enabled != flock.Behaviors[k].Enabled {
+				t.Fatalf("behavior %q enabled %v after load", behavior.Name, behavior.Enabled)
+			}
+		}
+		flock.Step(1.0 / 60.0)
+		loaded.Step(1.0 / 60.0)
+		for i := range flock.Position {
+			if flock.Position[i] != loaded.Position[i] || flock.Heading[i] != loaded.Heading[i] {
+				t.Fatalf("boid %d differs after load", i)
+			}
+		}
+		flock.SpawnPredators(1)
+		loaded.SpawnPredators(1)
+		if !slices.Equal(loaded.Predators, flock.Predators) {
+			t.Fatalf("random predators differ after load")
+		}
+
+		if err := loaded.Load(bytes.NewReader(data[:len(data)/2])); err == nil {
+			t.Fatalf("expected error for truncated snapshot")
+		}
+
+		flock.AddObstacle(pointsObstacle{})
+		if err := flock.Save(&bytes.Buffer{}); err == nil {
+			t.Fatalf("expected error for saving a custom obstacle")
+		}
+
+		if !compress {
+			data[len(data)/2] ^= 0xFF
+			if err := loaded.Load(bytes.NewReader(data)); err != ErrSnapshotChecksum {
+				t.Fatalf("expected checksum error, got %v", err)
+			}
+		}
+	}
+}
+
+func TestSnapshotInvalid(t *testing.T) {
+	// snapshots with a valid checksum, but values that do not validate
+	for name, corrupt := range map[string]func(flock *Flock){
+		"settings":    func(flock *Flock) { flock.Settings.CellRadius = -1 },
+		"interaction": func(flock *Flock) { flock.SetInteraction(0, 0, Interaction(9)) },
+		"heading":     func(flock *Flock) { flock.Heading[0] = g.Vec3{} },
+		"obstacle":    func(flock *Flock) { flock.AddObstacle(&Sphere{Radius: float32(math.NaN())}) },
+	} {
+		flock := NewFlock(10, 1)
+		defer flock.Close()
+		corrupt(flock)
+		var buf bytes.Buffer
+		if err := flock.Save(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		loaded := NewFlock(5, 2)
+		defer loaded.Close()
+		if err := loaded.Load(&buf); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if loaded.Count() != 5 || loaded.Settings.CellRadius != 5 || len(loaded.Obstacles) != 0 {
+			t.Errorf("%s: flock was modified", name)
+		}
+	}
+}
+
+func TestStepAllocs(t *testing.T) {
+	for _, mode := range []Mode{CellAverage, Neighborhood} {
+		flock := NewFlock(2000, 1)
+		flock.Settings.Mode = mode
+		flock.Procs = 4
+		flock.SpawnPredators(2)
+		other, _ := flock.AddSpecies(DefaultSpecies(), 500)
+		flock.SetInteraction(0, other, Avoid)
+		flock.SetInteraction(other, 0, Ignore)
+		flock.AddField(&Vortex{Axis: g.V3(0, 1, 0), Radius: 10, Strength: 2})
+		flock.AddField(&CurlNoise{Scale: 20, Strength: 1, Speed: 0.1})
+		err := flock.SetTimeline(&Timeline{Duration: 4, Tracks: []Track{
+			{Name: "Settings.CohesionWeight", Keys: []Key{{Time: 0, Value: 1}, {Time: 2, Value: 2}}},
+			{Name: "Settings.Mode", Keys: []Key{{Time: 0, Value: float32(mode)}}},
+			{Name: "Targets.0.Weight", Keys: []Key{{Time: 0, Value: 0}, {Time: 2, Value: 1, Interpolation: Smoothstep}}},
+			{Name: "Targets.0.Path.Speed", Keys: []Key{{Time: 0, Value: 0.5}}},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// warm-up over a full period of the cell radius oscillation
+		for i := 0; i < 400; i++ {
+			flock.Step(1.0 / 60.0)
+		}
+
+		allocs := testing.AllocsPerRun(50, func() {
+			flock.Step(1.0 / 60.0)
+		})
+		flock.Close()
+
+		if allocs != 0 {
+			t.Errorf("%v: got %v allocs per step", mode, allocs)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package sim
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/adinfinit/g"
+)
+
+// Field is an ambient velocity field that moves boids along with it.
+//
+// Fields are usually pointers, so that they can be changed between steps.
+type Field interface {
+	// At returns the velocity of the field at p and time t in seconds.
+	At(p g.Vec3, t float64) g.Vec3
+}
+
+// Wind is a uniform velocity with gusts oscillating at Frequency radians per second.
+type Wind struct {
+	Velocity  g.Vec3
+	Gust      g.Vec3
+	Frequency float32
+}
+
+func (wind *Wind) At(p g.Vec3, t float64) g.Vec3 {
+	if wind.Gust == (g.Vec3{}) {
+		return wind.Velocity
+	}
+	gust := float32(math.Sin(t * float64(wind.Frequency)))
+	return wind.Velocity.Add(wind.Gust.Mul(gust))
+}
+
+// Vortex swirls around Axis through Center.
+//
+// Within Radius the field rotates like a solid body,
+// outside the speed decreases with distance.
+type Vortex struct {
+	Center g.Vec3
+	Axis   g.Vec3
+	Radius float32
+	// Strength is the speed at Radius, positive is counter-clockwise around Axis.
+	Strength float32
+}
+
+func (vortex *Vortex) At(p g.Vec3, t float64) g.Vec3 {
+	axis := normalize(vortex.Axis)
+	if axis == (g.Vec3{}) {
+		axis = g.V3(0, 1, 0)
+	}
+
+	delta := p.Sub(vortex.Center)
+	radial := delta.Sub(axis.Mul(delta.Dot(axis)))
+	r := radial.Len()
+	if r == 0 || vortex.Radius <= 0 {
+		return g.Vec3{}
+	}
+
+	speed := vortex.Strength * vortex.Radius / r
+	if r < vortex.Radius {
+		speed = vortex.Strength * r / vortex.Radius
+	}
+	return axis.Cross(radial).Mul(speed / r)
+}
+
+// CurlNoise is divergence free turbulence, so it does not bunch boids together.
+type CurlNoise struct {
+	// Scale is the size of the swirls.
+	Scale    float32
+	Strength float32
+	// Speed is how fast the turbulence changes.
+	Speed float32
+	Seed  uint32
+}
+
+func (noise *CurlNoise) At(p g.Vec3, t float64) g.Vec3 {
+	if noise.Scale <= 0 {
+		return g.Vec3{}
+	}
+	const eps = 1e-2
+
+	p = p.Mul(1 / noise.Scale)
+	// wrap the time offset, so that float32 keeps enough precision
+	shift := float32(math.Mod(t*float64(noise.Speed), 256))
+	p = p.Add(g.V3(shift, shift, shift))
+
+	// the potential has one noise per axis
+	potential := func(q g.Vec3) g.Vec3 {
+		return g.V3(
+			gradientNoise(q, noise.Seed),
+			gradientNoise(q, noise.Seed+1),
+			gradientNoise(q, noise.Seed+2),
+		)
+	}
+	dx := potential(p.Add(g.V3(eps, 0, 0))).Sub(potential(p.Sub(g.V3(eps, 0, 0))))
+	dy := potential(p.Add(g.V3(0, eps, 0))).Sub(potential(p.Sub(g.V3(0, eps, 0))))
+	dz := potential(p.Add(g.V3(0, 0, eps))).Sub(potential(p.Sub(g.V3(0, 0, eps))))
+
+	curl := g.V3(dy.Z-dz.Y, dz.X-dx.Z, dx.Y-dy.X)
+	return curl.Mul(noise.Strength / (2 * eps))
+}
+
+// gradients are the directions used by gradientNoise.
+var gradients = [...]g.Vec3{
+	{X: 1, Y: 1}, {X: -1, Y: 1}, {X: 1, Y: -1}, {X: -1, Y: -1},
+	{X: 1, Z: 1}, {X: -1, Z: 1}, {X: 1, Z: -1}, {X: -1, Z: -1},
+	{Y: 1, Z: 1}, {Y: -1, Z: 1}, {Y: 1, Z: -1}, {Y: -1, Z: -1},
+}
+
+// gradientNoise is Perlin noise in about [-1, 1].
+func gradientNoise(p g.Vec3, seed uint32) float32 {
+	x, y, z := floor32(p.X), floor32(p.Y), floor32(p.Z)
+	f := g.V3(p.X-float32(x), p.Y-float32(y), p.Z-float32(z))
+	fade := func(t float32) float32 { return t * t * t * (t*(t*6-15) + 10) }
+	u, v, w := fade(f.X), fade(f.Y), fade(f.Z)
+
+	corner := func(dx, dy, dz int32) float32 {
+		h := uint32(x+dx)*0x8da6b343 ^ uint32(y+dy)*0xd8163841 ^ uint32(z+dz)*0xcb1ab31f ^ seed*0x9e3779b9
+		h ^= h >> 13
+		h *= 0x85ebca6b
+		h ^= h >> 16
+		return gradients[h%uint32(len(gradients))].Dot(f.Sub(g.V3(float32(dx), float32(dy), float32(dz))))
+	}
+
+	lerp := func(a, b, t float32) float32 { return a + (b-a)*t }
+	return lerp(
+		lerp(lerp(corner(0, 0, 0), corner(1, 0, 0), u), lerp(corner(0, 1, 0), corner(1, 1, 0), u), v),
+		lerp(lerp(corner(0, 0, 1), corner(1, 0, 1), u), lerp(corner(0, 1, 1), corner(1, 1, 1), u), v),
+		w)
+}
+
+// VectorGrid is a velocity field sampled on a regular grid,
+// it is zero outside of the grid.
+type VectorGrid struct {
+	// Origin is the position of the first sample.
+	Origin  g.Vec3
+	Spacing float32
+	Size    [3]int
+	// Velocities are ordered by x, then y, then z.
+	Velocities []g.Vec3
+}
+
+func (grid *VectorGrid) At(p g.Vec3, t float64) g.Vec3 {
+	if grid.Spacing <= 0 {
+		return g.Vec3{}
+	}
+	local := p.Sub(grid.Origin).Mul(1 / grid.Spacing)
+
+	var base [3]int
+	var frac [3]float32
+	for axis, v := range [3]float32{local.X, local.Y, local.Z} {
+		last := grid.Size[axis] - 1
+		if v < 0 || v > float32(last) || last < 0 {
+			return g.Vec3{}
+		}
+		i := min(int(v), max(last-1, 0))
+		base[axis], frac[axis] = i, v-float32(i)
+	}
+
+	at := func(x, y, z int) g.Vec3 {
+		x = min(x, grid.Size[0]-1)
+		y = min(y, grid.Size[1]-1)
+		z = min(z, grid.Size[2]-1)
+		return grid.Velocities[x+grid.Size[0]*(y+grid.Size[1]*z)]
+	}
+	x, y, z := base[0], base[1], base[2]
+	u, v, w := frac[0], frac[1], frac[2]
+	near := at(x, y, z).Lerp(at(x+1, y, z), u).Lerp(at(x, y+1, z).Lerp(at(x+1, y+1, z), u), v)
+	far := at(x, y, z+1).Lerp(at(x+1, y, z+1), u).Lerp(at(x, y+1, z+1).Lerp(at(x+1, y+1, z+1), u), v)
+	return near.Lerp(far, w)
+}
+
+// maxVectorGridSamples limits the size of loaded grids.
+const maxVectorGridSamples = 1 << 24
+
+// ReadVectorGrid reads a grid in text format:
+//
+//	# comments and empty lines are ignored
+//	size    nx ny nz
+//	origin  x y z
+//	spacing s
+//	vx vy vz        nx*ny*nz lines, ordered by x, then y, then z
+func ReadVectorGrid(r io.Reader) (*VectorGrid, error) {
+	grid := &VectorGrid{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	next := func() (string, bool) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text != "" && !strings.HasPrefix(text, "#") {
+				return text, true
+			}
+		}
+		return "", false
+	}
+	parse := func(text string, format string, values ...any) error {
+		if _, err := fmt.Sscanf(text, format, values...); err != nil {
+			return fmt.Errorf("unable to parse vector grid line %d: %w", line, err)
+		}
+		return nil
+	}
+
+	header := []struct {
+		format string
+		values []any
+	}{
+		{"size %d %d %d", []any{&grid.Size[0], &grid.Size[1], &grid.Size[2]}},
+		{"origin %g %g %g", []any{&grid.Origin.X, &grid.Origin.Y, &grid.Origin.Z}},
+		{"spacing %g", []any{&grid.Spacing}},
+	}
+	for _, field := range header {
+		text, ok := next()
+		if !ok {
+			return nil, errors.New("unexpected end of vector grid header")
+		}
+		if err := parse(text, field.format, field.values...); err != nil {
+			return nil, err
+		}
+	}
+
+	nx, ny, nz := grid.Size[0], grid.Size[1], grid.Size[2]
+	if nx <= 0 || ny <= 0 || nz <= 0 ||
+		nx > maxVectorGridSamples || ny > maxVectorGridSamples/nx || nz > maxVectorGridSamples/(nx*ny) {
+		return nil, fmt.Errorf("invalid vector grid size %v", grid.Size)
+	}
+	if grid.Spacing <= 0 {
+		return nil, fmt.Errorf("invalid vector grid spacing %v", grid.Spacing)
+	}
+
+	grid.Velocities = make([]g.Vec3, nx*ny*nz)
+	for i := range grid.Velocities {
+		text, ok := next()
+		if !ok {
+			return nil, fmt.Errorf("expected %d vectors, got %d", len(grid.Velocities), i)
+		}
+		v := &grid.Velocities[i]
+		if err := parse(text, "%g %g %g", &v.X, &v.Y, &v.Z); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read vector grid: %w", err)
+	}
+	return grid, nil
+}
+
+// AddField adds a velocity field that moves the boids.
+func (flock *Flock) AddField(field Field) {
+	flock.Fields = append(flock.Fields, field)
+}
+
+// RemoveField removes a previously added field.
+// Fields of non-comparable types, such as structs with slices,
+// can only be removed when they were added as pointers.
+func (flock *Flock) RemoveField(field Field) bool {
+	for i, other := range flock.Fields {
+		if same(other, field) {
+			flock.Fields = append(flock.Fields[:i], flock.Fields[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// flow returns the total velocity of all fields at pos.
+func (flock *Flock) flow(pos g.Vec3) g.Vec3 {
+	total := g.Vec3{}
+	for _, field := range flock.Fields {
+		total = total.Add(field.At(pos, flock.Time))
+	}
+	return total
+}
@@ -0,0 +1,120 @@
+package sim
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestFields(t *testing.T) {
+	grid := &VectorGrid{
+		Origin:  g.V3(-1, -1, -1),
+		Spacing: 2,
+		Size:    [3]int{2, 2, 2},
+		Velocities: []g.Vec3{
+			{}, {X: 2}, {}, {X: 2},
+			{}, {X: 2}, {}, {X: 2},
+		},
+	}
+
+	tests := []struct {
+		field    Field
+		p        g.Vec3
+		t        float64
+		expected g.Vec3
+	}{
+		{&Wind{Velocity: g.V3(1, 0, 0)}, g.V3(5, 5, 5), 3, g.V3(1, 0, 0)},
+		{&Wind{Velocity: g.V3(1, 0, 0), Gust: g.V3(0, 2, 0), Frequency: g.Pi}, g.Vec3{}, 0.5, g.V3(1, 2, 0)},
+		{&Vortex{Axis: g.V3(0, 1, 0), Radius: 2, Strength: 4}, g.V3(1, 7, 0), 0, g.V3(0, 0, -2)},
+		{&Vortex{Axis: g.V3(0, 1, 0), Radius: 2, Strength: 4}, g.V3(0, 0, 8), 0, g.V3(1, 0, 0)},
+		{grid, g.V3(0, 0.5, 0.5), 0, g.V3(1, 0, 0)},
+		{grid, g.V3(-0.5, 0, 0), 0, g.V3(0.5, 0, 0)},
+		{grid, g.V3(3, 0, 0), 0, g.Vec3{}},
+	}
+
+	for _, test := range tests {
+		got := test.field.At(test.p, test.t)
+		if got.Sub(test.expected).Len() > 1e-5 {
+			t.Errorf("%T at %v: got %v expected %v", test.field, test.p, got, test.expected)
+		}
+	}
+}
+
+func TestCurlNoiseDivergence(t *testing.T) {
+	noise := &CurlNoise{Scale: 10, Strength: 1, Speed: 0.5}
+	const eps = 0.05
+
+	total := float32(0)
+	for i := 0; i < 100; i++ {
+		p := g.V3(float32(i)*1.7, float32(i%7)*2.3, float32(i%13)*0.9)
+		at := func(offset g.Vec3) g.Vec3 { return noise.At(p.Add(offset), 3) }
+
+		divergence := (at(g.V3(eps, 0, 0)).X - at(g.V3(-eps, 0, 0)).X +
+			at(g.V3(0, eps, 0)).Y - at(g.V3(0, -eps, 0)).Y +
+			at(g.V3(0, 0, eps)).Z - at(g.V3(0, 0, -eps)).Z) / (2 * eps)
+		if g.Abs(divergence) > 0.05 {
+			t.Errorf("divergence %v at %v", divergence, p)
+		}
+		total += noise.At(p, 3).Len()
+	}
+	if total == 0 {
+		t.Errorf("curl noise is zero")
+	}
+}
+
+func TestReadVectorGrid(t *testing.T) {
+	grid, err := ReadVectorGrid(strings.NewReader(`
+		# a single cell
+		size 2 1 1
+		origin 0 0 0
+		spacing 4
+
+		1 0 0
+		3 0 0
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := grid.At(g.V3(1, 0, 0), 0); got != g.V3(1.5, 0, 0) {
+		t.Errorf("got %v", got)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"size 2 1 1\norigin 0 0 0\nspacing 0\n1 0 0\n1 0 0",
+		"size 2 1 1\norigin 0 0 0\nspacing 1\n1 0 0",
+		"size 1 1 1\norigin 0 0 0\nspacing 1\n1 x 0",
+		"size 100000 100000 100000\norigin 0 0 0\nspacing 1",
+	} {
+		if _, err := ReadVectorGrid(strings.NewReader(invalid)); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func TestAdvection(t *testing.T) {
+	for _, mode := range []Mode{CellAverage, Neighborhood} {
+		flock := NewFlock(1, 1)
+		defer flock.Close()
+		flock.Settings.Mode = mode
+		flock.Settings.MinSpeed = 0
+		flock.Species[0].MinSpeed = 0
+		flock.Settings.MaxAcceleration = 0
+		flock.Speed[0] = 0
+		flock.Position[0] = g.Vec3{}
+
+		wind := &Wind{Velocity: g.V3(3, 0, 0)}
+		flock.AddField(wind)
+		for i := 0; i < 10; i++ {
+			flock.Step(0.1)
+		}
+		if got := flock.Position[0]; got.Sub(g.V3(3, 0, 0)).Len() > 1e-4 {
+			t.Errorf("%v: got %v", mode, got)
+		}
+
+		if !flock.RemoveField(wind) || flock.RemoveField(wind) {
+			t.Errorf("remove failed")
+		}
+	}
+}
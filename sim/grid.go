@@ -0,0 +1,273 @@
+package sim
+
+import (
+	"math"
+	"slices"
+
+	"github.com/adinfinit/g"
+)
+
+// Grid is a uniform spatial grid, where boids are ordered by their cell
+// using a parallel counting sort.
+//
+// When the boids are spread too far apart for a dense grid, the cells
+// are ordered by sorting instead, which produces the same ordering.
+type Grid struct {
+	// BoidCell is the cell of each boid.
+	BoidCell []Cell
+	// Index contains boid indices ordered by cell,
+	// boids within a cell are in ascending order.
+	Index []int32
+	// Cells contains the non-empty cells in Z, Y, X order,
+	// boids in Cells[k] are Index[Start[k]:Start[k+1]].
+	Cells []Cell
+	Start []int32
+
+	dense     bool
+	min, size Cell
+	// cellStart is the offset into Index for each dense cell.
+	cellStart []int32
+	// histogram contains per-thread boid counts for each dense cell,
+	// after the prefix sum it contains the per-thread write offsets.
+	histogram [][]int32
+	// counters is the number of threads counting and scattering boids.
+	counters int
+	chunks   []gridChunk
+
+	blockMin, blockMax []Cell
+
+	pool      *pool
+	position  []g.Vec3
+	invradius float32
+}
+
+// gridChunk is the number of boids and non-empty cells in a range of dense cells.
+type gridChunk struct{ boids, cells int32 }
+
+const (
+	gridLocate = iota
+	gridCount
+	gridChunkSize
+	gridOffsets
+	gridScatter
+)
+
+// denseLimit returns the maximum number of dense cells used for count boids.
+func denseLimit(count int) int64 { return 2*int64(count) + 1<<16 }
+
+// Build places boids into cells that are radius wide using threads goroutines.
+func (grid *Grid) Build(position []g.Vec3, radius float32, threads int) {
+	n := len(position)
+	if threads < 1 {
+		threads = 1
+	}
+	if grid.pool == nil {
+		grid.pool = &pool{}
+	}
+
+	grid.BoidCell = resize(grid.BoidCell, n)
+	grid.Index = resize(grid.Index, n)
+	if n == 0 {
+		grid.dense = false
+		grid.Cells = grid.Cells[:0]
+		grid.Start = append(grid.Start[:0], 0)
+		return
+	}
+
+	grid.position = position
+	grid.invradius = 1 / radius
+	grid.blockMin = resize(grid.blockMin, threads)
+	grid.blockMax = resize(grid.blockMax, threads)
+	grid.pool.run(threads, grid, gridLocate)
+	grid.position = nil
+
+	min, max := grid.blockMin[0], grid.blockMax[0]
+	for tid := 1; tid < threads; tid++ {
+		min = min.Min(grid.blockMin[tid])
+		max = max.Max(grid.blockMax[tid])
+	}
+
+	sx := int64(max.X) - int64(min.X) + 1
+	sy := int64(max.Y) - int64(min.Y) + 1
+	sz := int64(max.Z) - int64(min.Z) + 1
+	if sx*sy*sz > denseLimit(n) {
+		grid.sortCells()
+		return
+	}
+
+	grid.dense = true
+	grid.min = min
+	grid.size = Cell{int32(sx), int32(sy), int32(sz)}
+	grid.countingSort(int(sx*sy*sz), threads)
+}
+
+// countingSort orders boids using per-thread histograms of the dense cells.
+// The number of histograms is limited so that together they have no more
+// than denseLimit cells, sparse grids are counted by fewer threads.
+//
+// The prefix sum over the histograms is done in parallel over chunks of cells,
+// first finding the size of each chunk and then assigning the offsets.
+func (grid *Grid) countingSort(cells, threads int) {
+	grid.counters = int(min(int64(threads), max(denseLimit(len(grid.BoidCell))/int64(cells), 1)))
+	grid.histogram = resize(grid.histogram, grid.counters)
+	grid.pool.run(grid.counters, grid, gridCount)
+
+	grid.chunks = resize(grid.chunks, threads)
+	grid.pool.run(threads, grid, gridChunkSize)
+
+	var total gridChunk
+	for tid, chunk := range grid.chunks {
+		grid.chunks[tid] = total
+		total.boids += chunk.boids
+		total.cells += chunk.cells
+	}
+
+	grid.Cells = resize(grid.Cells, int(total.cells))
+	grid.Start = resize(grid.Start, int(total.cells)+1)
+	grid.Start[total.cells] = total.boids
+	grid.cellStart = resize(grid.cellStart, cells+1)
+	grid.cellStart[cells] = total.boids
+
+	grid.pool.run(threads, grid, gridOffsets)
+	grid.pool.run(grid.counters, grid, gridScatter)
+}
+
+func (grid *Grid) runTask(phase, tid, threads int) {
+	n := len(grid.BoidCell)
+	cells := int(grid.size.X) * int(grid.size.Y) * int(grid.size.Z)
+
+	switch phase {
+	case gridLocate:
+		start, limit := blockRange(n, threads, tid)
+		min := Cell{math.MaxInt32, math.MaxInt32, math.MaxInt32}
+		max := Cell{math.MinInt32, math.MinInt32, math.MinInt32}
+		for i := start; i < limit; i++ {
+			cell := cellOf(grid.position[i], grid.invradius)
+			grid.BoidCell[i] = cell
+			min = min.Min(cell)
+			max = max.Max(cell)
+		}
+		grid.blockMin[tid], grid.blockMax[tid] = min, max
+
+	case gridCount:
+		histogram := resize(grid.histogram[tid], cells)
+		clear(histogram)
+
+		start, limit := blockRange(n, threads, tid)
+		for _, cell := range grid.BoidCell[start:limit] {
+			histogram[grid.denseIndex(cell)]++
+		}
+		grid.histogram[tid] = histogram
+
+	case gridChunkSize:
+		start, limit := blockRange(cells, threads, tid)
+		var chunk gridChunk
+		for c := start; c < limit; c++ {
+			count := int32(0)
+			for _, histogram := range grid.histogram[:grid.counters] {
+				count += histogram[c]
+			}
+			chunk.boids += count
+			if count > 0 {
+				chunk.cells++
+			}
+		}
+		grid.chunks[tid] = chunk
+
+	case gridOffsets:
+		start, limit := blockRange(cells, threads, tid)
+		offset, k := grid.chunks[tid].boids, grid.chunks[tid].cells
+		for c := start; c < limit; c++ {
+			first := offset
+			grid.cellStart[c] = first
+			for _, histogram := range grid.histogram[:grid.counters] {
+				count := histogram[c]
+				histogram[c] = offset
+				offset += count
+			}
+			if offset > first {
+				grid.Cells[k] = grid.denseCell(c)
+				grid.Start[k] = first
+				k++
+			}
+		}
+
+	case gridScatter:
+		// each thread scatters its own block in ascending order,
+		// which keeps the boids within a cell sorted
+		histogram := grid.histogram[tid]
+		start, limit := blockRange(n, threads, tid)
+		for i := start; i < limit; i++ {
+			c := grid.denseIndex(grid.BoidCell[i])
+			grid.Index[histogram[c]] = int32(i)
+			histogram[c]++
+		}
+	}
+}
+
+// sortCells orders boids by sorting, used when the dense grid would be too large.
+func (grid *Grid) sortCells() {
+	grid.dense = false
+	for i := range grid.Index {
+		grid.Index[i] = int32(i)
+	}
+	slices.SortFunc(grid.Index, func(a, b int32) int {
+		if c := compareCell(grid.BoidCell[a], grid.BoidCell[b]); c != 0 {
+			return c
+		}
+		return int(a - b)
+	})
+
+	grid.Cells = grid.Cells[:0]
+	grid.Start = grid.Start[:0]
+	for k, i := range grid.Index {
+		cell := grid.BoidCell[i]
+		if k == 0 || cell != grid.Cells[len(grid.Cells)-1] {
+			grid.Cells = append(grid.Cells, cell)
+			grid.Start = append(grid.Start, int32(k))
+		}
+	}
+	grid.Start = append(grid.Start, int32(len(grid.Index)))
+}
+
+// Lookup returns the boids in cell.
+func (grid *Grid) Lookup(cell Cell) []int32 {
+	if grid.dense {
+		x, y, z := cell.X-grid.min.X, cell.Y-grid.min.Y, cell.Z-grid.min.Z
+		if x < 0 || y < 0 || z < 0 || x >= grid.size.X || y >= grid.size.Y || z >= grid.size.Z {
+			return nil
+		}
+		c := grid.denseIndex(cell)
+		return grid.Index[grid.cellStart[c]:grid.cellStart[c+1]]
+	}
+
+	k, found := slices.BinarySearchFunc(grid.Cells, cell, compareCell)
+	if !found {
+		return nil
+	}
+	return grid.Index[grid.Start[k]:grid.Start[k+1]]
+}
+
+func (grid *Grid) denseIndex(cell Cell) int {
+	x := int(cell.X - grid.min.X)
+	y := int(cell.Y - grid.min.Y)
+	z := int(cell.Z - grid.min.Z)
+	return x + int(grid.size.X)*(y+int(grid.size.Y)*z)
+}
+
+func (grid *Grid) denseCell(c int) Cell {
+	sx, sy := int(grid.size.X), int(grid.size.Y)
+	return Cell{
+		X: grid.min.X + int32(c%sx),
+		Y: grid.min.Y + int32(c/sx%sy),
+		Z: grid.min.Z + int32(c/(sx*sy)),
+	}
+}
+
+// resize returns a slice of length n, reusing the backing array when possible.
+func resize[T any](s []T, n int) []T {
+	if cap(s) < n {
+		return make([]T, n)
+	}
+	return s[:n]
+}
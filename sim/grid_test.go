@@ -0,0 +1,157 @@
+package sim
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func randomPositions(n int, spread float32, seed int64) []g.Vec3 {
+	rng := rand.New(rand.NewSource(seed))
+	position := make([]g.Vec3, n)
+	for i := range position {
+		position[i] = g.V3(
+			(rng.Float32()-0.5)*spread,
+			(rng.Float32()-0.5)*spread,
+			(rng.Float32()-0.5)*spread,
+		)
+	}
+	return position
+}
+
+func TestGridDenseMatchesSorted(t *testing.T) {
+	position := randomPositions(10000, 40, 1)
+
+	var dense, sorted Grid
+	dense.Build(position, 2, 3)
+	if !dense.dense {
+		t.Fatal("expected dense grid")
+	}
+
+	sorted.BoidCell = make([]Cell, len(position))
+	sorted.Index = make([]int32, len(position))
+	for i, p := range position {
+		sorted.BoidCell[i] = cellOf(p, 0.5)
+	}
+	sorted.sortCells()
+
+	if !slices.Equal(dense.Index, sorted.Index) ||
+		!slices.Equal(dense.Cells, sorted.Cells) ||
+		!slices.Equal(dense.Start, sorted.Start) {
+		t.Fatal("dense and sorted grid differ")
+	}
+
+	for k, cell := range dense.Cells {
+		boids := dense.Index[dense.Start[k]:dense.Start[k+1]]
+		if !slices.Equal(dense.Lookup(cell), boids) || !slices.Equal(sorted.Lookup(cell), boids) {
+			t.Fatalf("lookup %v mismatch", cell)
+		}
+		for _, i := range boids {
+			if dense.BoidCell[i] != cell {
+				t.Fatalf("boid %d in wrong cell", i)
+			}
+		}
+		if !slices.IsSorted(boids) {
+			t.Fatalf("boids in cell %v not sorted", cell)
+		}
+	}
+
+	if dense.Lookup(Cell{1000, 0, 0}) != nil || sorted.Lookup(Cell{1000, 0, 0}) != nil {
+		t.Fatal("expected empty lookup")
+	}
+}
+
+func TestGridHistogramLimit(t *testing.T) {
+	// sparse enough for few boids per cell, but still dense
+	position := randomPositions(1000, 36, 2)
+
+	var dense, sorted Grid
+	dense.Build(position, 1, 16)
+	if !dense.dense {
+		t.Fatal("expected dense grid")
+	}
+	total := 0
+	for _, histogram := range dense.histogram[:dense.counters] {
+		total += len(histogram)
+	}
+	if limit := denseLimit(len(position)); int64(total) > limit {
+		t.Errorf("got %d histogram cells for %d threads, expected at most %d", total, dense.counters, limit)
+	}
+
+	sorted.BoidCell = slices.Clone(dense.BoidCell)
+	sorted.Index = make([]int32, len(position))
+	sorted.sortCells()
+	if !slices.Equal(dense.Index, sorted.Index) ||
+		!slices.Equal(dense.Cells, sorted.Cells) ||
+		!slices.Equal(dense.Start, sorted.Start) {
+		t.Fatal("dense and sorted grid differ")
+	}
+}
+
+const mapThreads = 2
+
+// mapGrid is the previous map based implementation, kept for comparison.
+type mapGrid struct {
+	CellHash    [mapThreads]map[Cell][]int32
+	CellIndices [][]int32
+}
+
+func (grid *mapGrid) build(position []g.Vec3, radius float32) {
+	for _, table := range grid.CellHash {
+		for cell, list := range table {
+			table[cell] = list[:0]
+		}
+	}
+
+	invradius := 1 / radius
+	for tid := range grid.CellHash {
+		start, limit := blockRange(len(position), mapThreads, tid)
+		cellhash := grid.CellHash[tid]
+		for offset, p := range position[start:limit] {
+			cell := cellOf(p, invradius)
+			cellhash[cell] = append(cellhash[cell], int32(start+offset))
+		}
+	}
+
+	merge := grid.CellHash[0]
+	for _, table := range grid.CellHash[1:] {
+		for cell, indices := range table {
+			merge[cell] = append(merge[cell], indices...)
+		}
+	}
+
+	grid.CellIndices = resize(grid.CellIndices, len(merge))
+	nextIndex := 0
+	for _, indices := range merge {
+		grid.CellIndices[nextIndex] = indices
+		nextIndex++
+	}
+}
+
+func BenchmarkGrid(b *testing.B) {
+	for _, n := range []int{10000, 100000, 1000000} {
+		position := randomPositions(n, 40, 1)
+
+		b.Run(fmt.Sprintf("map/%d", n), func(b *testing.B) {
+			grid := &mapGrid{}
+			for i := range grid.CellHash {
+				grid.CellHash[i] = make(map[Cell][]int32, n/10)
+			}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				grid.build(position, 3)
+			}
+		})
+
+		b.Run(fmt.Sprintf("counting/%d", n), func(b *testing.B) {
+			grid := &Grid{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				grid.Build(position, 3, mapThreads)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/adinfinit/g"
+)
+
+// headingTolerance is how far the length of a heading may be from 1.
+const headingTolerance = 1e-3
+
+// Health checks the flock for NaN, Inf and non-unit headings after
+// each phase of Step. Checking costs a pass over the data of each phase.
+type Health struct {
+	// Respawn replaces invalid boids and predators with random ones,
+	// otherwise Step panics with the first *Fault.
+	Respawn bool
+	// OnFault is called with the first fault of a step,
+	// before respawning, for example to save a snapshot.
+	OnFault func(flock *Flock, fault *Fault)
+
+	// Faults is the number of faults found.
+	Faults int
+	// Last is the last fault reported to OnFault.
+	Last *Fault
+}
+
+// Fault describes an invalid value found by Health.
+type Fault struct {
+	Frame int
+	// Phase is the phase of Step that produced the value,
+	// "start" means it was invalid before the step.
+	Phase string
+	// Kind is "boid", "predator" or "cell".
+	Kind  string
+	Index int
+	// Field is the invalid field, such as "Position".
+	Field string
+}
+
+func (fault *Fault) Error() string {
+	return fmt.Sprintf("frame %d: %s %d has invalid %s after %s", fault.Frame, fault.Kind, fault.Index, fault.Field, fault.Phase)
+}
+
+// checkHealth checks the data written by phase.
+func (flock *Flock) checkHealth(phase string) {
+	health := flock.Health
+	if health == nil {
+		return
+	}
+
+	first := true
+	report := func(kind string, index int, field string) {
+		health.Faults++
+		if !first {
+			return
+		}
+		first = false
+		fault := &Fault{Frame: flock.Frame, Phase: phase, Kind: kind, Index: index, Field: field}
+		if health.OnFault != nil {
+			health.OnFault(flock, fault)
+		}
+		health.Last = fault
+		if !health.Respawn {
+			panic(fault)
+		}
+	}
+
+	switch phase {
+	case "start", "steerAndMove":
+		for i := range flock.Position {
+			if field := flock.invalidBoid(i); field != "" {
+				report("boid", i, field)
+				flock.randomize(i, i+1)
+			}
+		}
+		if phase == "start" {
+			flock.checkPredators(report)
+		}
+	case "chase":
+		flock.checkPredators(report)
+	case "computeCells":
+		for i := range flock.CellTarget {
+			switch {
+			case !finite(flock.CellTarget[i]):
+				report("cell", i, "CellTarget")
+			case !finite(flock.CellAlignment[i]):
+				report("cell", i, "CellAlignment")
+			case !finite(flock.CellSeparation[i]):
+				report("cell", i, "CellSeparation")
+			}
+		}
+	}
+}
+
+// invalidBoid returns the first invalid field of boid i, or "" when it is valid.
+func (flock *Flock) invalidBoid(i int) string {
+	switch {
+	case !finite(flock.Position[i]):
+		return "Position"
+	case !finite(flock.Heading[i]) || g.Abs(flock.Heading[i].Len()-1) > headingTolerance:
+		return "Heading"
+	case !finite32(flock.Speed[i]):
+		return "Speed"
+	}
+	return ""
+}
+
+// checkPredators reports and respawns invalid predators.
+func (flock *Flock) checkPredators(report func(kind string, index int, field string)) {
+	for i := range flock.Predators {
+		predator := &flock.Predators[i]
+		field := ""
+		switch {
+		case !finite(predator.Position):
+			field = "Position"
+		case !finite(predator.Heading) || g.Abs(predator.Heading.Len()-1) > headingTolerance:
+			field = "Heading"
+		default:
+			continue
+		}
+		report("predator", i, field)
+		manual := predator.Manual
+		*predator = flock.randomPredator()
+		predator.Manual = manual
+	}
+}
+
+// finite returns whether all components of v are finite.
+func finite(v g.Vec3) bool {
+	return finite32(v.X) && finite32(v.Y) && finite32(v.Z)
+}
+
+func finite32(v float32) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
@@ -0,0 +1,87 @@
+package sim
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestHealth(t *testing.T) {
+	nan := float32(math.NaN())
+	poison := BehaviorFunc(func(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+		if boid.Index == 3 {
+			return g.V3(nan, 0, 0), 1
+		}
+		return g.Vec3{}, 0
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		flock := NewFlock(10, 1)
+		defer flock.Close()
+		flock.AddBehavior("poison", poison)
+
+		var snapshot bytes.Buffer
+		flock.Health = &Health{OnFault: func(flock *Flock, fault *Fault) {
+			if err := flock.Save(&snapshot); err != nil {
+				t.Error(err)
+			}
+		}}
+
+		defer func() {
+			fault, ok := recover().(*Fault)
+			if !ok {
+				t.Fatal("expected a fault")
+			}
+			if fault.Phase != "steerAndMove" || fault.Kind != "boid" || fault.Index != 3 {
+				t.Errorf("got %v", fault)
+			}
+			if snapshot.Len() == 0 {
+				t.Errorf("snapshot was not saved")
+			}
+		}()
+		flock.Step(0.1)
+	})
+
+	t.Run("respawn", func(t *testing.T) {
+		flock := NewFlock(10, 1)
+		defer flock.Close()
+		flock.Health = &Health{Respawn: true}
+		flock.AddBehavior("poison", poison)
+		flock.SpawnPredators(1)
+		flock.Predators[0].Heading = g.V3(0, 0, 2)
+
+		for i := 0; i < 5; i++ {
+			flock.Step(0.1)
+		}
+		// the predator once, then boid 3 every step
+		if flock.Health.Faults != 6 {
+			t.Errorf("got %v faults, expected 6", flock.Health.Faults)
+		}
+		if last := flock.Health.Last; last == nil || last.Kind != "boid" || last.Index != 3 {
+			t.Errorf("got last fault %v", last)
+		}
+		for i := range flock.Position {
+			if field := flock.invalidBoid(i); field != "" {
+				t.Errorf("boid %v has invalid %v", i, field)
+			}
+		}
+		if heading := flock.Predators[0].Heading; g.Abs(heading.Len()-1) > headingTolerance {
+			t.Errorf("predator was not respawned: %v", heading)
+		}
+	})
+
+	t.Run("start", func(t *testing.T) {
+		flock := NewFlock(10, 1)
+		defer flock.Close()
+		flock.Health = &Health{Respawn: true}
+		flock.Speed[7] = float32(math.Inf(1))
+
+		flock.Step(0.1)
+		last := flock.Health.Last
+		if last == nil || last.Phase != "start" || last.Index != 7 || last.Field != "Speed" {
+			t.Errorf("got %v", last)
+		}
+	})
+}
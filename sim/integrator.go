@@ -0,0 +1,133 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/adinfinit/g"
+)
+
+// Integrator is how boids are moved over a step.
+//
+// The neighbors of a boid are gathered once per step,
+// integrators only reevaluate the steering with them.
+type Integrator int32
+
+const (
+	// ExplicitEuler moves with the velocity from the start of the step.
+	ExplicitEuler Integrator = iota
+	// SemiImplicitEuler turns first and moves with the new velocity.
+	SemiImplicitEuler
+	// Verlet moves with the average of the velocities at the start and end of the step.
+	Verlet
+	// RK4 integrates the heading, speed and position with Runge-Kutta,
+	// steering four times per step.
+	RK4
+)
+
+func (integrator Integrator) String() string {
+	switch integrator {
+	case ExplicitEuler:
+		return "euler"
+	case SemiImplicitEuler:
+		return "semi-implicit"
+	case Verlet:
+		return "verlet"
+	case RK4:
+		return "rk4"
+	default:
+		return "unknown"
+	}
+}
+
+// maxSubsteps limits Settings.MaxSubsteps.
+const maxSubsteps = 64
+
+// updateSubsteps splits dt into substeps no longer than Settings.MaxStep.
+func (flock *Flock) updateSubsteps(dt float32) {
+	settings := &flock.Settings
+
+	flock.substeps = 1
+	if settings.MaxStep > 0 && dt > settings.MaxStep {
+		n := math.Ceil(float64(dt / settings.MaxStep))
+		limit := float64(g.Clamp(float32(settings.MaxSubsteps), 1, maxSubsteps))
+		flock.substeps = int(math.Min(n, limit))
+	}
+	flock.dt = dt / float32(flock.substeps)
+}
+
+// integrate moves a boid over all substeps of the current step.
+func (flock *Flock) integrate(boid Boid, near Neighbors) Boid {
+	for step := 0; step < flock.substeps; step++ {
+		boid = flock.integrateStep(boid, near)
+		boid.Position, boid.Heading = flock.confine(boid.Position, boid.Heading)
+	}
+	return boid
+}
+
+// integrateStep moves a boid over a single substep.
+func (flock *Flock) integrateStep(boid Boid, near Neighbors) Boid {
+	dt := flock.dt
+
+	switch flock.Settings.Integrator {
+	case ExplicitEuler:
+		velocity := flock.velocity(boid)
+		boid.Heading, boid.Speed = flock.turn(boid.Heading, boid.Speed, boid.Species, flock.steer(boid, near))
+		boid.Position = boid.Position.Add(velocity.Mul(dt))
+
+	case Verlet:
+		before := flock.velocity(boid)
+		boid.Heading, boid.Speed = flock.turn(boid.Heading, boid.Speed, boid.Species, flock.steer(boid, near))
+		moved := boid
+		moved.Position = boid.Position.Add(before.Mul(dt))
+		after := flock.velocity(moved)
+		boid.Position = boid.Position.Add(before.Add(after).Mul(dt / 2))
+
+	case RK4:
+		k1 := flock.derive(boid, near)
+		k2 := flock.derive(k1.apply(boid, dt/2), near)
+		k3 := flock.derive(k2.apply(boid, dt/2), near)
+		k4 := flock.derive(k3.apply(boid, dt), near)
+		sum := derivative{
+			velocity: k1.velocity.Add(k2.velocity.Add(k3.velocity).Mul(2)).Add(k4.velocity).Mul(1.0 / 6),
+			rotate:   k1.rotate.Add(k2.rotate.Add(k3.rotate).Mul(2)).Add(k4.rotate).Mul(1.0 / 6),
+			accel:    (k1.accel + 2*(k2.accel+k3.accel) + k4.accel) / 6,
+		}
+		boid.Position = boid.Position.Add(sum.velocity.Mul(dt))
+		boid.Heading, boid.Speed = flock.advance(boid.Heading, boid.Speed, boid.Species, sum.rotate, sum.accel)
+
+	default:
+		boid.Heading, boid.Speed = flock.turn(boid.Heading, boid.Speed, boid.Species, flock.steer(boid, near))
+		boid.Position = boid.Position.Add(flock.velocity(boid).Mul(dt))
+	}
+	return boid
+}
+
+// velocity returns the velocity of a boid including the ambient flow.
+func (flock *Flock) velocity(boid Boid) g.Vec3 {
+	velocity := boid.Heading.Mul(boid.Speed)
+	if len(flock.Fields) > 0 {
+		velocity = velocity.Add(flock.flow(boid.Position))
+	}
+	return velocity
+}
+
+// derivative is the rate of change of a boid.
+type derivative struct {
+	velocity g.Vec3
+	rotate   g.Vec3
+	accel    float32
+}
+
+// derive steers a boid and returns its rate of change.
+func (flock *Flock) derive(boid Boid, near Neighbors) derivative {
+	rotate, accel := flock.accelerate(boid.Heading, boid.Speed, flock.steer(boid, near))
+	return derivative{velocity: flock.velocity(boid), rotate: rotate, accel: accel}
+}
+
+// apply returns boid changed at the rate of d over dt.
+func (d derivative) apply(boid Boid, dt float32) Boid {
+	boid.Position = boid.Position.Add(d.velocity.Mul(dt))
+	boid.Heading = safeNormalize(boid.Heading.Add(d.rotate.Mul(dt)), 1)
+	boid.Speed += d.accel * dt
+	return boid
+}
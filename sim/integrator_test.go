@@ -0,0 +1,169 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+// drifter returns a flock with a single boid that only moves with the flow.
+func drifter(integrator Integrator) *Flock {
+	flock := NewFlock(1, 1)
+	for i := range flock.Behaviors {
+		flock.Behaviors[i].Enabled = false
+	}
+	flock.Settings.Integrator = integrator
+	flock.Settings.MaxStep = 0
+	flock.Settings.MinSpeed = 0
+	flock.Species[0].MinSpeed = 0
+	flock.Settings.MaxAcceleration = 0
+	flock.Position[0] = g.V3(3, 0, 0)
+	flock.Heading[0] = g.V3(0, 0, 1)
+	flock.Speed[0] = 0
+	return flock
+}
+
+func TestIntegratorEnergy(t *testing.T) {
+	// solid body rotation at 1 radian per second, the exact orbit keeps its radius
+	vortex := &Vortex{Axis: g.V3(0, 1, 0), Radius: 10, Strength: 10}
+
+	drift := map[Integrator]float32{}
+	for _, integrator := range []Integrator{ExplicitEuler, SemiImplicitEuler, Verlet, RK4} {
+		flock := drifter(integrator)
+		flock.AddField(vortex)
+		for i := 0; i < 100; i++ {
+			flock.Step(0.1)
+		}
+		flock.Close()
+		drift[integrator] = g.Abs(flock.Position[0].Len()/3 - 1)
+	}
+
+	// explicit methods spiral outwards by about 1.01^50
+	if d := drift[ExplicitEuler]; d < 0.5 || d > 0.8 {
+		t.Errorf("euler: radius drifted by %v, expected about 0.64", d)
+	}
+	if d := drift[Verlet]; d > 0.005 {
+		t.Errorf("verlet: radius drifted by %v", d)
+	}
+	if d := drift[RK4]; d > 1e-4 {
+		t.Errorf("rk4: radius drifted by %v", d)
+	}
+	if !(drift[RK4] < drift[Verlet] && drift[Verlet] < drift[ExplicitEuler]) {
+		t.Errorf("unexpected drift order %v", drift)
+	}
+}
+
+func TestIntegratorHeading(t *testing.T) {
+	push := BehaviorFunc(func(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+		return g.V3(1, 0, 0), 1
+	})
+	turning := func(integrator Integrator, dt float32, steps int) *Flock {
+		flock := drifter(integrator)
+		flock.Settings.MaxTurnRate = 8
+		flock.Speed[0] = 5
+		flock.AddBehavior("push", push)
+		for i := 0; i < steps; i++ {
+			flock.Step(dt)
+		}
+		flock.Close()
+		return flock
+	}
+
+	reference := turning(RK4, 0.001, 2000)
+	miss := map[Integrator]float32{}
+	for _, integrator := range []Integrator{ExplicitEuler, SemiImplicitEuler, Verlet, RK4} {
+		flock := turning(integrator, 0.2, 10)
+		miss[integrator] = flock.Position[0].Sub(reference.Position[0]).Len()
+		if flock.Heading[0].Sub(reference.Heading[0]).Len() > 0.1 {
+			t.Errorf("%v: heading %v, expected %v", integrator, flock.Heading[0], reference.Heading[0])
+		}
+	}
+
+	if miss[RK4] > 1e-3 {
+		t.Errorf("rk4: position error %v", miss[RK4])
+	}
+	for _, integrator := range []Integrator{ExplicitEuler, SemiImplicitEuler, Verlet} {
+		if miss[RK4] >= miss[integrator] {
+			t.Errorf("rk4 error %v is not below %v error %v", miss[RK4], integrator, miss[integrator])
+		}
+	}
+}
+
+func TestSubsteps(t *testing.T) {
+	push := BehaviorFunc(func(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+		return g.V3(1, 0, 0), 1
+	})
+	for _, integrator := range []Integrator{ExplicitEuler, SemiImplicitEuler, Verlet, RK4} {
+		whole := drifter(integrator)
+		whole.Speed[0] = 5
+		whole.AddBehavior("push", push)
+		whole.Settings.MaxStep = 0.1
+		whole.Step(0.4)
+		whole.Close()
+		if whole.substeps != 4 {
+			t.Errorf("%v: got %v substeps, expected 4", integrator, whole.substeps)
+		}
+
+		split := drifter(integrator)
+		split.Speed[0] = 5
+		split.AddBehavior("push", push)
+		for i := 0; i < 4; i++ {
+			split.Step(0.1)
+		}
+		split.Close()
+
+		if whole.Position[0].Sub(split.Position[0]).Len() > 1e-4 || whole.Heading[0].Sub(split.Heading[0]).Len() > 1e-4 {
+			t.Errorf("%v: substeps moved to %v, expected %v", integrator, whole.Position[0], split.Position[0])
+		}
+	}
+
+	flock := drifter(SemiImplicitEuler)
+	defer flock.Close()
+	flock.Settings.MaxStep = 0.01
+	flock.Settings.MaxSubsteps = 3
+	flock.Step(1)
+	if flock.substeps != 3 {
+		t.Errorf("got %v substeps, expected MaxSubsteps", flock.substeps)
+	}
+}
+
+func TestHitch(t *testing.T) {
+	// one long step, such as after a hitch, follows the same path as short steps
+	target := g.V3(0, 0, 2)
+	seek := BehaviorFunc(func(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+		return target.Sub(boid.Position), 1
+	})
+	run := func(maxStep float32, steps int) *Flock {
+		flock := drifter(SemiImplicitEuler)
+		flock.Position[0] = g.Vec3{}
+		flock.Heading[0] = g.V3(1, 0, 0)
+		flock.Speed[0] = 5
+		flock.Settings.MinSpeed = 5
+		flock.Settings.MaxTurnRate = 8
+		flock.AddBehavior("seek", seek)
+		flock.AddPredator(Predator{Position: g.V3(0, 0, -5), Heading: g.V3(1, 0, 0)})
+		flock.Settings.MaxStep = maxStep
+		for i := 0; i < steps; i++ {
+			flock.Step(0.5 / float32(steps))
+		}
+		flock.Close()
+		return flock
+	}
+
+	reference := run(0, 500)
+	hitch := run(1.0/30, 1)
+	unsplit := run(0, 1)
+
+	// the boid turns while it flies past the target
+	deviation := func(flock *Flock) float32 { return flock.Position[0].Sub(reference.Position[0]).Len() }
+	if deviation(hitch) > 0.1 || deviation(unsplit) < 2*deviation(hitch) {
+		t.Errorf("one long step moves the boid to %v, expected %v", hitch.Position[0], reference.Position[0])
+	}
+
+	miss := func(flock *Flock) float32 {
+		return flock.Predators[0].Position.Sub(reference.Predators[0].Position).Len()
+	}
+	if miss(hitch) > 0.5 || miss(unsplit) < miss(hitch) {
+		t.Errorf("one long step moves the predator %v from %v", miss(hitch), reference.Predators[0].Position)
+	}
+}
@@ -0,0 +1,94 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/adinfinit/g"
+)
+
+// turn turns a boid towards the steering force and adjusts its speed.
+//
+// The heading turns towards the direction of force, limited by
+// Settings.MaxTurnRate. The part of force along the heading accelerates
+// the boid against Settings.Drag, limited by Settings.MaxAcceleration,
+// and the speed is kept within the speed range of the species and the settings.
+func (flock *Flock) turn(head g.Vec3, speed float32, species int, force g.Vec3) (g.Vec3, float32) {
+	rotate, accel := flock.accelerate(head, speed, force)
+	return flock.advance(head, speed, species, rotate, accel)
+}
+
+// accelerate returns the change of heading and speed per second caused by force.
+func (flock *Flock) accelerate(head g.Vec3, speed float32, force g.Vec3) (rotate g.Vec3, accel float32) {
+	settings := &flock.Settings
+
+	// only the part perpendicular to the heading turns it
+	desired := safeNormalize(force, 1)
+	rotate = desired.Sub(head.Mul(desired.Dot(head)))
+	if rotate.Len2() < 1e-6 && desired.Dot(head) < 0 && force.Len2() >= 1e-3 {
+		// steering straight back, turn to either side
+		rotate = perpendicular(head)
+	}
+	if settings.MaxAcceleration > 0 {
+		accel = force.Dot(head) - settings.Drag*speed
+		accel = g.Clamp(accel, -settings.MaxAcceleration, settings.MaxAcceleration)
+	}
+	return rotate, accel
+}
+
+// advance applies the change of heading and speed over a step,
+// within the limits of the settings.
+func (flock *Flock) advance(head g.Vec3, speed float32, species int, rotate g.Vec3, accel float32) (g.Vec3, float32) {
+	settings := &flock.Settings
+	dt := flock.dt
+
+	next := safeNormalize(head.Add(rotate.Mul(dt)), 1)
+	if settings.MaxTurnRate > 0 {
+		next = limitTurn(head, next, flock.maxTurnCos, flock.maxTurnSin)
+	}
+
+	minSpeed, maxSpeed := flock.speedRange(species)
+	speed = g.Max(speed+accel*dt, minSpeed)
+	if maxSpeed > 0 {
+		speed = g.Min(speed, maxSpeed)
+	}
+
+	return next, speed
+}
+
+// speedRange returns the intersection of the speed ranges of species
+// and the settings, 0 maxSpeed is unlimited. When they do not overlap
+// the maximum wins.
+func (flock *Flock) speedRange(species int) (minSpeed, maxSpeed float32) {
+	settings := &flock.Settings
+	limits := &flock.Species[species]
+
+	minSpeed = g.Max(settings.MinSpeed, limits.MinSpeed)
+	maxSpeed = settings.MaxSpeed
+	if limits.MaxSpeed > 0 && (maxSpeed == 0 || limits.MaxSpeed < maxSpeed) {
+		maxSpeed = limits.MaxSpeed
+	}
+	return minSpeed, maxSpeed
+}
+
+// updateTurnLimit precomputes the largest rotation of a single step.
+func (flock *Flock) updateTurnLimit() {
+	angle := float64(flock.Settings.MaxTurnRate * flock.dt)
+	if angle > math.Pi {
+		angle = math.Pi
+	}
+	sn, cs := math.Sincos(angle)
+	flock.maxTurnSin, flock.maxTurnCos = float32(sn), float32(cs)
+}
+
+// limitTurn rotates head towards next by at most the angle with cosine cs and sine sn.
+func limitTurn(head, next g.Vec3, cs, sn float32) g.Vec3 {
+	along := head.Dot(next)
+	if along >= cs {
+		return next
+	}
+	side := normalize(next.Sub(head.Mul(along)))
+	if side == (g.Vec3{}) {
+		side = perpendicular(head)
+	}
+	return head.Mul(cs).Add(side.Mul(sn))
+}
@@ -0,0 +1,112 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestKinematics(t *testing.T) {
+	single := func() *Flock {
+		flock := NewFlock(1, 1)
+		for i := range flock.Behaviors {
+			flock.Behaviors[i].Enabled = false
+		}
+		flock.Position[0] = g.Vec3{}
+		flock.Heading[0] = g.V3(0, 0, 1)
+		flock.Speed[0] = 5
+		return flock
+	}
+	push := func(direction g.Vec3, weight float32) Behavior {
+		return BehaviorFunc(func(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+			return direction, weight
+		})
+	}
+
+	t.Run("turn rate", func(t *testing.T) {
+		flock := single()
+		defer flock.Close()
+		flock.Settings.MaxTurnRate = 0.5
+		flock.AddBehavior("push", push(g.V3(1, 0, 0), 1))
+
+		flock.Step(0.5)
+		angle := float32(math.Acos(float64(flock.Heading[0].Dot(g.V3(0, 0, 1)))))
+		if g.Abs(angle-0.25) > 1e-3 {
+			t.Errorf("turned %v radians, expected 0.25", angle)
+		}
+	})
+
+	t.Run("accelerate", func(t *testing.T) {
+		flock := single()
+		defer flock.Close()
+		flock.AddBehavior("push", push(g.V3(0, 0, 1), 10))
+
+		flock.Step(0.5)
+		if expected := 5 + flock.Settings.MaxAcceleration*0.5; flock.Speed[0] != expected {
+			t.Errorf("got speed %v, expected %v", flock.Speed[0], expected)
+		}
+		for i := 0; i < 100; i++ {
+			flock.Step(0.5)
+		}
+		if _, maxSpeed := flock.speedRange(0); flock.Speed[0] != maxSpeed {
+			t.Errorf("got speed %v, expected max speed %v", flock.Speed[0], maxSpeed)
+		}
+	})
+
+	t.Run("drag", func(t *testing.T) {
+		flock := single()
+		defer flock.Close()
+		for i := 0; i < 200; i++ {
+			flock.Step(0.5)
+		}
+		if minSpeed, _ := flock.speedRange(0); flock.Speed[0] != minSpeed {
+			t.Errorf("got speed %v, expected min speed %v", flock.Speed[0], minSpeed)
+		}
+	})
+
+	t.Run("head-on", func(t *testing.T) {
+		flock := single()
+		defer flock.Close()
+		flock.AddBehavior("push", push(g.V3(0, 0, -1), 1))
+
+		for i := 0; i < 300; i++ {
+			flock.Step(1.0 / 30)
+		}
+		if along := flock.Heading[0].Dot(g.V3(0, 0, -1)); along < 0.9 {
+			t.Errorf("got heading %v, expected to turn around", flock.Heading[0])
+		}
+	})
+
+	t.Run("species speed", func(t *testing.T) {
+		flock := NewFlock(500, 1)
+		defer flock.Close()
+		fast := DefaultSpecies()
+		fast.MinSpeed, fast.MaxSpeed = 9, 11
+		if _, err := flock.AddSpecies(fast, 500); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 0; i < 300; i++ {
+			flock.Step(1.0 / 30)
+		}
+		for i, speed := range flock.Speed {
+			species := flock.Species[flock.SpeciesIndex[i]]
+			if speed < species.MinSpeed || speed > species.MaxSpeed {
+				t.Fatalf("%s boid %d has speed %v outside [%v, %v]", species.Name, i, speed, species.MinSpeed, species.MaxSpeed)
+			}
+		}
+	})
+
+	t.Run("constant", func(t *testing.T) {
+		flock := single()
+		defer flock.Close()
+		flock.Settings.MaxAcceleration = 0
+		for i := 0; i < 10; i++ {
+			flock.Step(0.5)
+		}
+		if flock.Speed[0] != 5 {
+			t.Errorf("got speed %v, expected 5", flock.Speed[0])
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package sim
+
+import (
+	"reflect"
+
+	"github.com/adinfinit/g"
+)
+
+func safeNormalize(v g.Vec3, s float32) g.Vec3 {
+	l := v.Len2()
+	if l < 1e-3 {
+		return g.V3(0, 0, s)
+	}
+	return v.Mul(s / g.Sqrt(l))
+}
+
+// normalize returns v with unit length, or zero when v is zero.
+func normalize(v g.Vec3) g.Vec3 {
+	l := v.Len2()
+	if l == 0 {
+		return g.Vec3{}
+	}
+	return v.Mul(1 / g.Sqrt(l))
+}
+
+// perpendicular returns a unit vector perpendicular to v.
+func perpendicular(v g.Vec3) g.Vec3 {
+	axis := g.V3(0, 1, 0)
+	if g.Abs(v.Y) > 0.9*v.Len() {
+		axis = g.V3(1, 0, 0)
+	}
+	return safeNormalize(v.Cross(axis), 1)
+}
+
+// blockRange returns the k-th of n equally sized blocks of [0, count).
+func blockRange(count, n, k int) (start, limit int) {
+	return count * k / n, count * (k + 1) / n
+}
+
+// splitMix is a random source with a single word of state,
+// so that it can be saved and restored.
+type splitMix struct{ state uint64 }
+
+func (source *splitMix) Seed(seed int64) { source.state = uint64(seed) }
+
+func (source *splitMix) Uint64() uint64 {
+	source.state += 0x9e3779b97f4a7c15
+	z := source.state
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+func (source *splitMix) Int63() int64 { return int64(source.Uint64() >> 1) }
+
+// same returns whether a and b are the same value, values of
+// non-comparable types are never the same instead of panicking.
+func same(a, b any) bool {
+	return reflect.TypeOf(a) == reflect.TypeOf(b) && reflect.ValueOf(a).Comparable() && a == b
+}
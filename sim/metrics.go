@@ -0,0 +1,210 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/adinfinit/g"
+)
+
+// Metrics describe the collective behavior of the flock.
+//
+// Nearest neighbors are found across the sides of Wrap bounds,
+// but the centroid, milling and extent use the wrapped positions,
+// so a flock crossing a side is measured as spread over the bounds.
+type Metrics struct {
+	Frame int
+
+	// Polarization is the length of the average heading,
+	// 1 when all boids head the same way and near 0 when disordered.
+	Polarization float32
+	// Milling is the normalized angular momentum around the centroid,
+	// 1 when all boids circle the centroid in the same direction.
+	Milling float32
+
+	// NeighborRadius is the cell radius of the last step,
+	// nearest neighbors are only searched within it.
+	NeighborRadius float32
+	// MeanNearestWithin and MinNearestWithin are the mean and smallest distance
+	// to the nearest neighbor of the boids that have one within NeighborRadius,
+	// the isolated boids are left out.
+	MeanNearestWithin float32
+	MinNearestWithin  float32
+	// Isolated is the number of boids without a neighbor within NeighborRadius.
+	Isolated int
+
+	// Extent is the size of the bounding box of the flock.
+	Extent g.Vec3
+	// Radius is the root mean square distance from the centroid.
+	Radius float32
+
+	Centroid g.Vec3
+	// Velocity is the velocity of the centroid.
+	Velocity g.Vec3
+}
+
+// metricsPart are the sums of a block of boids.
+type metricsPart struct {
+	count    int
+	heading  g.Vec3
+	position g.Vec3
+	velocity g.Vec3
+	min, max g.Vec3
+
+	momentum  g.Vec3
+	distance  float32
+	distance2 float32
+
+	nearest    float32
+	nearestMin float32
+	neighbors  int
+}
+
+// Metrics computes the metrics of the flock in parallel.
+func (flock *Flock) Metrics() Metrics {
+	metrics := Metrics{Frame: flock.Frame}
+	n := flock.Count()
+	if n == 0 {
+		return metrics
+	}
+
+	threads := max(flock.Procs, 1)
+	flock.metricsParts = resize(flock.metricsParts, threads)
+	clear(flock.metricsParts)
+
+	flock.pool.run(threads, flock, phaseMetricsSums)
+	var heading, position, velocity g.Vec3
+	low, high := flock.Position[0], flock.Position[0]
+	for i := range flock.metricsParts {
+		part := &flock.metricsParts[i]
+		if part.count == 0 {
+			continue
+		}
+		heading = heading.Add(part.heading)
+		position = position.Add(part.position)
+		velocity = velocity.Add(part.velocity)
+		low, high = low.Min(part.min), high.Max(part.max)
+	}
+	byCount := 1 / float32(n)
+	metrics.Polarization = heading.Len() * byCount
+	metrics.Centroid = position.Mul(byCount)
+	metrics.Velocity = velocity.Mul(byCount)
+	metrics.Extent = high.Sub(low)
+
+	flock.metricsCentroid = metrics.Centroid
+	flock.metricsRadius = flock.radius
+	if !(flock.metricsRadius > 0) {
+		flock.metricsRadius = flock.Settings.CellRadius
+	}
+	if !(flock.metricsRadius > 0) {
+		flock.metricsRadius = 1
+	}
+	metrics.NeighborRadius = flock.metricsRadius
+	flock.metricsGrid.Build(flock.Position, flock.metricsRadius, threads)
+	flock.pool.run(threads, flock, phaseMetricsSpread)
+
+	var momentum g.Vec3
+	var distance, distance2, nearest float32
+	neighbors := 0
+	metrics.MinNearestWithin = float32(math.Inf(1))
+	for i := range flock.metricsParts {
+		part := &flock.metricsParts[i]
+		momentum = momentum.Add(part.momentum)
+		distance += part.distance
+		distance2 += part.distance2
+		nearest += part.nearest
+		neighbors += part.neighbors
+		if part.neighbors > 0 {
+			metrics.MinNearestWithin = g.Min(metrics.MinNearestWithin, part.nearestMin)
+		}
+	}
+	if distance > 0 {
+		metrics.Milling = momentum.Len() / distance
+	}
+	metrics.Radius = g.Sqrt(distance2 * byCount)
+	metrics.Isolated = n - neighbors
+	if neighbors > 0 {
+		metrics.MeanNearestWithin = nearest / float32(neighbors)
+	} else {
+		metrics.MinNearestWithin = 0
+	}
+	return metrics
+}
+
+// sumMetricsRange sums the headings, positions and velocities of a block of boids,
+// the velocities include the flow of the fields.
+func (flock *Flock) sumMetricsRange(tid, start, limit int) {
+	if start >= limit {
+		return
+	}
+	part := &flock.metricsParts[tid]
+	part.count = limit - start
+	part.min, part.max = flock.Position[start], flock.Position[start]
+	for i := start; i < limit; i++ {
+		pos, head := flock.Position[i], flock.Heading[i]
+		part.heading = part.heading.Add(head)
+		part.position = part.position.Add(pos)
+		part.velocity = part.velocity.Add(flock.velocity(Boid{Index: i, Position: pos, Heading: head, Speed: flock.Speed[i]}))
+		part.min, part.max = part.min.Min(pos), part.max.Max(pos)
+	}
+}
+
+// spreadMetricsRange sums the angular momentum, distances from the centroid
+// and nearest neighbor distances of a block of boids.
+func (flock *Flock) spreadMetricsRange(tid, start, limit int) {
+	part := &flock.metricsParts[tid]
+	centroid := flock.metricsCentroid
+	radius := flock.metricsRadius
+	periodic := flock.periodic(radius)
+
+	for i := start; i < limit; i++ {
+		pos := flock.Position[i]
+		offset := pos.Sub(centroid)
+		part.momentum = part.momentum.Add(offset.Cross(flock.Heading[i]))
+		distance2 := offset.Len2()
+		part.distance += g.Sqrt(distance2)
+		part.distance2 += distance2
+
+		nearest2, found := flock.nearestNeighbor(i, pos, radius*radius)
+		if periodic {
+			// look from the images of pos on the opposite sides
+			shift := flock.wrapShift(pos, radius)
+			for mask := 1; mask < 8; mask++ {
+				image, ok := periodicImage(pos, shift, mask)
+				if !ok {
+					continue
+				}
+				if dist2, ok := flock.nearestNeighbor(i, image, nearest2); ok {
+					nearest2, found = dist2, true
+				}
+			}
+		}
+		if !found {
+			continue
+		}
+		nearest := g.Sqrt(nearest2)
+		if part.neighbors == 0 || nearest < part.nearestMin {
+			part.nearestMin = nearest
+		}
+		part.nearest += nearest
+		part.neighbors++
+	}
+}
+
+// nearestNeighbor returns the squared distance from image to the nearest boid
+// other than i, when it is within nearest2. image is the position of boid i
+// or its periodic image.
+func (flock *Flock) nearestNeighbor(i int, image g.Vec3, nearest2 float32) (float32, bool) {
+	found := false
+	cell := cellOf(image, 1/flock.metricsRadius)
+	for _, neighbor := range neighborOffsets {
+		for _, j := range flock.metricsGrid.Lookup(cell.Offset(neighbor[0], neighbor[1], neighbor[2])) {
+			if int(j) == i {
+				continue
+			}
+			if dist2 := image.Sub(flock.Position[j]).Len2(); dist2 <= nearest2 {
+				nearest2, found = dist2, true
+			}
+		}
+	}
+	return nearest2, found
+}
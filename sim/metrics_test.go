@@ -0,0 +1,124 @@
+package sim
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/adinfinit/g"
+)
+
+func TestMetrics(t *testing.T) {
+	t.Run("lattice", func(t *testing.T) {
+		flock := NewFlock(27, 1)
+		defer flock.Close()
+		for i := range flock.Position {
+			flock.Position[i] = g.V3(float32(i%3), float32(i/3%3), float32(i/9)).Mul(2)
+			flock.Heading[i] = g.V3(1, 0, 0)
+			flock.Speed[i] = 3
+		}
+		// far away from the others
+		flock.Position[26] = g.V3(100, 0, 0)
+
+		metrics := flock.Metrics()
+		if metrics.Polarization < 0.999 || metrics.Milling > 1e-3 {
+			t.Errorf("got polarization %v and milling %v", metrics.Polarization, metrics.Milling)
+		}
+		if metrics.MeanNearestWithin != 2 || metrics.MinNearestWithin != 2 || metrics.Isolated != 1 {
+			t.Errorf("got nearest %v, min %v, isolated %v", metrics.MeanNearestWithin, metrics.MinNearestWithin, metrics.Isolated)
+		}
+		if metrics.Extent != g.V3(100, 4, 4) {
+			t.Errorf("got extent %v", metrics.Extent)
+		}
+		if metrics.Velocity.Sub(g.V3(3, 0, 0)).Len() > 1e-5 {
+			t.Errorf("got velocity %v", metrics.Velocity)
+		}
+	})
+
+	t.Run("flow", func(t *testing.T) {
+		flock := NewFlock(10, 1)
+		defer flock.Close()
+		for i := range flock.Position {
+			flock.Heading[i] = g.V3(1, 0, 0)
+			flock.Speed[i] = 3
+		}
+		flock.AddField(&Wind{Velocity: g.V3(0, 0, 2)})
+
+		metrics := flock.Metrics()
+		if metrics.Velocity.Sub(g.V3(3, 0, 2)).Len() > 1e-5 {
+			t.Errorf("got velocity %v, expected it to include the wind", metrics.Velocity)
+		}
+	})
+
+	t.Run("milling", func(t *testing.T) {
+		flock := NewFlock(64, 1)
+		defer flock.Close()
+		for i := range flock.Position {
+			sn, cs := g.Sincos(float32(i) * 2 * g.Pi / 64)
+			flock.Position[i] = g.V3(cs, 0, sn).Mul(5)
+			flock.Heading[i] = g.V3(-sn, 0, cs)
+		}
+
+		metrics := flock.Metrics()
+		if metrics.Milling < 0.999 || metrics.Polarization > 1e-3 {
+			t.Errorf("got milling %v and polarization %v", metrics.Milling, metrics.Polarization)
+		}
+		if metrics.Centroid.Len() > 1e-4 || g.Abs(metrics.Radius-5) > 1e-4 {
+			t.Errorf("got centroid %v and radius %v", metrics.Centroid, metrics.Radius)
+		}
+	})
+
+	t.Run("wrap", func(t *testing.T) {
+		flock := NewFlock(2, 1)
+		defer flock.Close()
+		flock.Settings.Bounds = Wrap
+		flock.Settings.BoundsShape = BoxBounds
+		flock.Settings.BoundsSize = 20
+		// neighbors across the side of the bounds
+		flock.Position[0] = g.V3(-19.5, 0, 0)
+		flock.Position[1] = g.V3(19.5, 0, 0)
+
+		metrics := flock.Metrics()
+		if metrics.Isolated != 0 || g.Abs(metrics.MeanNearestWithin-1) > 1e-4 {
+			t.Errorf("got nearest %v, isolated %v", metrics.MeanNearestWithin, metrics.Isolated)
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		flock := NewFlock(10000, 1)
+		defer flock.Close()
+		flock.MetricsInterval = 5
+		for i := 0; i < 10; i++ {
+			flock.Step(1.0 / 60)
+		}
+		if flock.LastMetrics.Frame != 10 {
+			t.Errorf("got metrics of frame %v", flock.LastMetrics.Frame)
+		}
+
+		flock.Procs = 1
+		serial := flock.Metrics()
+		flock.Procs = 7
+		parallel := flock.Metrics()
+		if serial.Isolated != parallel.Isolated || serial.MinNearestWithin != parallel.MinNearestWithin ||
+			g.Abs(serial.MeanNearestWithin-parallel.MeanNearestWithin) > 1e-4 ||
+			g.Abs(serial.Polarization-parallel.Polarization) > 1e-4 ||
+			g.Abs(serial.Milling-parallel.Milling) > 1e-4 {
+			t.Errorf("serial %+v and parallel %+v differ", serial, parallel)
+		}
+	})
+	t.Run("goroutines", func(t *testing.T) {
+		before := runtime.NumGoroutine()
+		flock := NewFlock(1000, 1)
+		flock.Procs = 4
+		flock.Metrics()
+		flock.Close()
+
+		// workers exit after Close returns
+		for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		if after := runtime.NumGoroutine(); after > before {
+			t.Errorf("%d goroutines left after Close", after-before)
+		}
+	})
+}
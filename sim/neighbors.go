@@ -0,0 +1,229 @@
+package sim
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/adinfinit/g"
+)
+
+// Mode selects how boids perceive their neighbors.
+type Mode int32
+
+const (
+	// CellAverage steers each boid using the averages of its own cell.
+	CellAverage Mode = iota
+	// Neighborhood steers each boid using all boids within CellRadius,
+	// looking through the 27 surrounding cells.
+	Neighborhood
+)
+
+func (mode Mode) String() string {
+	switch mode {
+	case CellAverage:
+		return "cell-average"
+	case Neighborhood:
+		return "neighborhood"
+	default:
+		return "unknown"
+	}
+}
+
+// neighborOffsets lists the 27 surrounding cells, starting with the center.
+var neighborOffsets = func() (offsets [27][3]int32) {
+	k := 1
+	for dz := int32(-1); dz <= 1; dz++ {
+		for dy := int32(-1); dy <= 1; dy++ {
+			for dx := int32(-1); dx <= 1; dx++ {
+				if dx == 0 && dy == 0 && dz == 0 {
+					continue
+				}
+				offsets[k] = [3]int32{dx, dy, dz}
+				k++
+			}
+		}
+	}
+	return offsets
+}()
+
+// steerNeighborhood computes headings with classic separation, alignment
+// and cohesion over neighbors within CellRadius. When MaxNeighbors is set,
+// only that many of the nearest ones are considered.
+//
+// New headings are computed before moving anyone, so that every boid
+// sees the same state of its neighbors.
+func (flock *Flock) steerNeighborhood() {
+	flock.nextPosition = resize(flock.nextPosition, flock.Count())
+	flock.nextHeading = resize(flock.nextHeading, flock.Count())
+	flock.candidates = resize(flock.candidates, max(flock.Procs, 1))
+	flock.pool.run(flock.Procs, flock, phaseSteerNeighborhood)
+	flock.pool.run(flock.Procs, flock, phaseMove)
+}
+
+// neighborSum accumulates the neighbors of a boid.
+type neighborSum struct {
+	separation g.Vec3
+	alignment  g.Vec3
+	center     g.Vec3
+	avoid      g.Vec3
+	count      int
+}
+
+// add adds a flocking neighbor at delta from the boid.
+func (sum *neighborSum) add(delta g.Vec3, dist2 float32, heading, center g.Vec3) {
+	if dist2 > 1e-6 {
+		sum.separation = sum.separation.Add(delta.Mul(1 / dist2))
+	}
+	sum.alignment = sum.alignment.Add(heading)
+	sum.center = sum.center.Add(center)
+	sum.count++
+}
+
+// candidate is a flocking neighbor kept until the nearest MaxNeighbors are known.
+type candidate struct {
+	index  int32
+	dist2  float32
+	delta  g.Vec3
+	center g.Vec3
+}
+
+func (flock *Flock) steerNeighborhoodRange(tid, start, limit int) {
+	radius := flock.radius
+	periodic := flock.periodic(radius)
+	maxNeighbors := int(flock.Settings.MaxNeighbors)
+	candidates := flock.candidates[tid]
+
+	for i := start; i < limit; i++ {
+		pos := flock.Position[i]
+		head := flock.Heading[i]
+
+		var sum neighborSum
+		candidates = flock.gatherNeighbors(&sum, candidates[:0], i, pos, pos)
+		if periodic {
+			// look from the images of pos on the opposite sides
+			shift := flock.wrapShift(pos, radius)
+			for mask := 1; mask < 8; mask++ {
+				if image, ok := periodicImage(pos, shift, mask); ok {
+					candidates = flock.gatherNeighbors(&sum, candidates, i, pos, image)
+				}
+			}
+		}
+		if maxNeighbors > 0 {
+			flock.sumNearest(&sum, candidates, maxNeighbors)
+		}
+
+		boid := Boid{Index: i, Position: pos, Heading: head, Speed: flock.Speed[i], Species: int(flock.SpeciesIndex[i])}
+		near := Neighbors{
+			Count:        sum.count,
+			Separation:   sum.separation,
+			Avoid:        sum.avoid,
+			Target:       flock.CellTarget[flock.CellIndex[i]],
+			TargetWeight: flock.CellTargetWeight[flock.CellIndex[i]],
+		}
+		near.Predator, near.Panic = flock.threat(pos)
+		if sum.count > 0 {
+			byCount := 1 / float32(sum.count)
+			near.Center = sum.center.Mul(byCount)
+			near.Alignment = sum.alignment.Mul(byCount)
+		}
+
+		// only the position and heading of neighbors are read, so the speed can be updated here
+		boid = flock.integrate(boid, near)
+		flock.nextPosition[i], flock.nextHeading[i], flock.Speed[i] = boid.Position, boid.Heading, boid.Speed
+	}
+	flock.candidates[tid] = candidates
+}
+
+// gatherNeighbors adds boids within CellRadius of image to sum,
+// where image is pos or its periodic image. Neighbor positions are
+// reported relative to pos. When MaxNeighbors is set, flocking neighbors
+// are appended to candidates instead.
+//
+// Ignored species are skipped and avoided species only add to sum.avoid.
+func (flock *Flock) gatherNeighbors(sum *neighborSum, candidates []candidate, i int, pos, image g.Vec3) []candidate {
+	radius := flock.radius
+	radius2 := radius * radius
+	limited := flock.Settings.MaxNeighbors > 0
+	offset := pos.Sub(image)
+
+	n := len(flock.Species)
+	species := int(flock.SpeciesIndex[i])
+	interactions := flock.interactions[species*n : (species+1)*n]
+
+	cell := cellOf(image, 1/radius)
+	for _, neighbor := range neighborOffsets {
+		for _, j := range flock.Grid.Lookup(cell.Offset(neighbor[0], neighbor[1], neighbor[2])) {
+			if int(j) == i {
+				continue
+			}
+			delta := image.Sub(flock.Position[j])
+			dist2 := delta.Len2()
+			if dist2 > radius2 {
+				continue
+			}
+			switch interactions[flock.SpeciesIndex[j]] {
+			case Ignore:
+				continue
+			case Avoid:
+				if dist2 > 1e-6 {
+					sum.avoid = sum.avoid.Add(delta.Mul(1 / dist2))
+				}
+				continue
+			}
+			center := flock.Position[j].Add(offset)
+			if limited {
+				candidates = append(candidates, candidate{index: j, dist2: dist2, delta: delta, center: center})
+				continue
+			}
+			sum.add(delta, dist2, flock.Heading[j], center)
+		}
+	}
+	return candidates
+}
+
+// sumNearest adds the nearest k of candidates to sum.
+func (flock *Flock) sumNearest(sum *neighborSum, candidates []candidate, k int) {
+	if len(candidates) > k {
+		// ties are broken by index, so that the result does not depend on the search order
+		slices.SortFunc(candidates, func(a, b candidate) int {
+			if a.dist2 != b.dist2 {
+				return cmp.Compare(a.dist2, b.dist2)
+			}
+			return cmp.Compare(a.index, b.index)
+		})
+		candidates = candidates[:k]
+	}
+	for _, c := range candidates {
+		sum.add(c.delta, c.dist2, flock.Heading[c.index], c.center)
+	}
+}
+
+// periodicImage returns pos shifted along the axes selected by mask,
+// ok is false when pos has no image along one of them.
+func periodicImage(pos, shift g.Vec3, mask int) (image g.Vec3, ok bool) {
+	image = pos
+	if mask&1 != 0 {
+		if shift.X == 0 {
+			return pos, false
+		}
+		image.X += shift.X
+	}
+	if mask&2 != 0 {
+		if shift.Y == 0 {
+			return pos, false
+		}
+		image.Y += shift.Y
+	}
+	if mask&4 != 0 {
+		if shift.Z == 0 {
+			return pos, false
+		}
+		image.Z += shift.Z
+	}
+	return image, true
+}
+
+func (flock *Flock) moveRange(start, limit int) {
+	copy(flock.Position[start:limit], flock.nextPosition[start:limit])
+	copy(flock.Heading[start:limit], flock.nextHeading[start:limit])
+}
@@ -0,0 +1,43 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestMaxNeighbors(t *testing.T) {
+	// the far boids share the cell of boid 0 and are found first,
+	// the near boids are in the neighboring cell
+	far := []g.Vec3{g.V3(0.8, 0.1, 0.1), g.V3(0.8, 0.2, 0.1), g.V3(0.8, 0.3, 0.1), g.V3(0.8, 0.4, 0.1)}
+	near := []g.Vec3{g.V3(-0.1, 0.1, 0.1), g.V3(-0.2, 0.1, 0.1)}
+
+	for _, maxNeighbors := range []int32{0, 2} {
+		flock := NewFlock(1+len(far)+len(near), 1)
+		defer flock.Close()
+		flock.Settings.Mode = Neighborhood
+		flock.Settings.CellRadius = 1
+		flock.Settings.CellRadiusWobble = 0
+		flock.Settings.MaxNeighbors = maxNeighbors
+		flock.Position[0] = g.V3(0.01, 0.1, 0.1)
+		copy(flock.Position[1:], far)
+		copy(flock.Position[1+len(far):], near)
+
+		recorder := &neighborRecorder{near: make([]Neighbors, flock.Count())}
+		flock.AddBehavior("record", recorder)
+		flock.Step(1.0 / 60)
+
+		got := recorder.near[0]
+		switch maxNeighbors {
+		case 0:
+			if got.Count != len(far)+len(near) {
+				t.Errorf("unlimited: got %d neighbors", got.Count)
+			}
+		default:
+			center := near[0].Add(near[1]).Mul(0.5)
+			if got.Count != 2 || got.Center.Sub(center).Len() > 1e-5 {
+				t.Errorf("limited: got %d neighbors around %v, expected the nearest around %v", got.Count, got.Center, center)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package sim
+
+import "github.com/adinfinit/g"
+
+// Obstacle is a solid shape that boids avoid.
+//
+// Obstacles are usually pointers, so that they can be moved between steps.
+type Obstacle interface {
+	// Distance returns the signed distance from p to the surface,
+	// negative inside, and the direction pointing away from the obstacle.
+	Distance(p g.Vec3) (distance float32, normal g.Vec3)
+}
+
+type Sphere struct {
+	Center g.Vec3
+	Radius float32
+}
+
+func (sphere *Sphere) Distance(p g.Vec3) (float32, g.Vec3) {
+	delta := p.Sub(sphere.Center)
+	length := delta.Len()
+	return length - sphere.Radius, safeNormalize(delta, 1)
+}
+
+// Box is an axis-aligned box.
+type Box struct {
+	Min, Max g.Vec3
+}
+
+func (box *Box) Distance(p g.Vec3) (float32, g.Vec3) {
+	center := box.Min.Add(box.Max).Mul(0.5)
+	half := box.Max.Sub(box.Min).Mul(0.5)
+
+	delta := p.Sub(center)
+	q := g.V3(g.Abs(delta.X), g.Abs(delta.Y), g.Abs(delta.Z)).Sub(half)
+	sign := g.V3(sign32(delta.X), sign32(delta.Y), sign32(delta.Z))
+
+	if q.X > 0 || q.Y > 0 || q.Z > 0 {
+		outside := q.Max(g.Vec3{})
+		return outside.Len(), safeNormalize(outside.Scale(sign), 1)
+	}
+
+	// inside, push out through the nearest face
+	switch {
+	case q.X >= q.Y && q.X >= q.Z:
+		return q.X, g.V3(sign.X, 0, 0)
+	case q.Y >= q.Z:
+		return q.Y, g.V3(0, sign.Y, 0)
+	default:
+		return q.Z, g.V3(0, 0, sign.Z)
+	}
+}
+
+// Plane is an infinite plane, the solid side is opposite to Normal.
+type Plane struct {
+	Point  g.Vec3
+	Normal g.Vec3
+}
+
+func (plane *Plane) Distance(p g.Vec3) (float32, g.Vec3) {
+	normal := safeNormalize(plane.Normal, 1)
+	return p.Sub(plane.Point).Dot(normal), normal
+}
+
+// Capsule is a segment from A to B with a radius.
+type Capsule struct {
+	A, B   g.Vec3
+	Radius float32
+}
+
+func (capsule *Capsule) Distance(p g.Vec3) (float32, g.Vec3) {
+	axis := capsule.B.Sub(capsule.A)
+	t := float32(0)
+	if length2 := axis.Len2(); length2 > 0 {
+		t = g.Clamp(p.Sub(capsule.A).Dot(axis)/length2, 0, 1)
+	}
+	delta := p.Sub(capsule.A.Add(axis.Mul(t)))
+	return delta.Len() - capsule.Radius, safeNormalize(delta, 1)
+}
+
+func sign32(v float32) float32 {
+	if v < 0 {
+		return -1
+	}
+	return 1
+}
+
+// AddObstacle adds an obstacle to the world.
+func (flock *Flock) AddObstacle(obstacle Obstacle) {
+	flock.Obstacles = append(flock.Obstacles, obstacle)
+}
+
+// RemoveObstacle removes a previously added obstacle.
+// Obstacles of non-comparable types, such as structs with slices,
+// can only be removed when they were added as pointers.
+func (flock *Flock) RemoveObstacle(obstacle Obstacle) bool {
+	for i, other := range flock.Obstacles {
+		if same(other, obstacle) {
+			flock.Obstacles = append(flock.Obstacles[:i], flock.Obstacles[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Avoidance steers away from obstacles near the boid or
+// in front of it within Settings.AvoidanceDistance.
+//
+// The weight is Settings.AvoidanceWeight scaled by how close the obstacle is.
+type Avoidance struct{}
+
+func (Avoidance) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	distance := flock.Settings.AvoidanceDistance
+	if len(flock.Obstacles) == 0 || distance <= 0 {
+		return g.Vec3{}, 0
+	}
+
+	steer := g.Vec3{}
+	urgency := float32(0)
+	for _, obstacle := range flock.Obstacles {
+		s, u := avoid(obstacle, boid, distance)
+		steer = steer.Add(s)
+		urgency = g.Max(urgency, u)
+	}
+
+	return sideways(steer, boid.Heading), flock.Settings.AvoidanceWeight * urgency
+}
+
+// avoid returns the direction away from obstacle scaled by urgency,
+// which grows from 0 to 2 as the boid or the point distance ahead
+// of it gets closer to the obstacle.
+func avoid(obstacle Obstacle, boid Boid, distance float32) (steer g.Vec3, urgency float32) {
+	ahead := boid.Position.Add(boid.Heading.Mul(distance))
+
+	d0, n0 := obstacle.Distance(boid.Position)
+	d1, n1 := obstacle.Distance(ahead)
+
+	d, normal := d0, n0
+	if d1 < d0 {
+		d, normal = d1, n1
+	}
+	if d >= distance {
+		return g.Vec3{}, 0
+	}
+
+	urgency = g.Min((distance-d)/distance, 2)
+	return normal.Mul(urgency), urgency
+}
+
+// sideways returns the direction of steer, turning steering that points
+// behind the boid into a sideways turn. Steering straight back would only
+// slow the boid down before it turns.
+func sideways(steer, heading g.Vec3) g.Vec3 {
+	steer = normalize(steer)
+	along := steer.Dot(heading)
+	if along >= 0 {
+		return steer
+	}
+	side := steer.Sub(heading.Mul(along))
+	if side.Len2() < 1e-6 {
+		return perpendicular(heading)
+	}
+	return normalize(side)
+}
@@ -0,0 +1,75 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestObstacleDistance(t *testing.T) {
+	tests := []struct {
+		obstacle Obstacle
+		p        g.Vec3
+		distance float32
+		normal   g.Vec3
+	}{
+		{&Sphere{Radius: 2}, g.V3(0, 5, 0), 3, g.V3(0, 1, 0)},
+		{&Sphere{Radius: 2}, g.V3(-1, 0, 0), -1, g.V3(-1, 0, 0)},
+		{&Box{Min: g.V3(-1, -1, -1), Max: g.V3(1, 1, 1)}, g.V3(0, 0, 3), 2, g.V3(0, 0, 1)},
+		{&Box{Min: g.V3(-1, -1, -1), Max: g.V3(1, 1, 1)}, g.V3(-0.5, 0, 0), -0.5, g.V3(-1, 0, 0)},
+		{&Box{Min: g.V3(-1, -1, -1), Max: g.V3(1, 1, 1)}, g.V3(4, 5, 0), 5, g.V3(0.6, 0.8, 0)},
+		{&Plane{Point: g.V3(0, -3, 0), Normal: g.V3(0, 2, 0)}, g.V3(7, 1, 7), 4, g.V3(0, 1, 0)},
+		{&Plane{Point: g.V3(0, -3, 0), Normal: g.V3(0, 2, 0)}, g.V3(7, -4, 7), -1, g.V3(0, 1, 0)},
+		{&Capsule{A: g.V3(0, 0, 0), B: g.V3(0, 10, 0), Radius: 1}, g.V3(3, 5, 0), 2, g.V3(1, 0, 0)},
+		{&Capsule{A: g.V3(0, 0, 0), B: g.V3(0, 10, 0), Radius: 1}, g.V3(0, 13, 0), 2, g.V3(0, 1, 0)},
+	}
+
+	for _, test := range tests {
+		distance, normal := test.obstacle.Distance(test.p)
+		if g.Abs(distance-test.distance) > 1e-5 || normal.Sub(test.normal).Len() > 1e-5 {
+			t.Errorf("%T %v: got (%v, %v) expected (%v, %v)",
+				test.obstacle, test.p, distance, normal, test.distance, test.normal)
+		}
+	}
+}
+
+func TestAvoidance(t *testing.T) {
+	flock := NewFlock(1000, 1)
+	defer flock.Close()
+
+	for _, name := range []string{"separation", "alignment", "cohesion", "target"} {
+		flock.EnableBehavior(name, false)
+	}
+	flock.AddBehavior("down", &constantBehavior{g.V3(0, -1, 0)})
+
+	floor := &Plane{Point: g.V3(0, -25, 0), Normal: g.V3(0, 1, 0)}
+	flock.AddObstacle(floor)
+
+	for i := 0; i < 300; i++ {
+		flock.Step(1.0 / 30.0)
+	}
+	for i, pos := range flock.Position {
+		if pos.Y < floor.Point.Y {
+			t.Fatalf("boid %d went through the floor: %v", i, pos)
+		}
+	}
+
+	if !flock.RemoveObstacle(floor) || flock.RemoveObstacle(floor) {
+		t.Errorf("remove failed")
+	}
+
+	// non-comparable values are not found, their pointers are
+	points := pointsObstacle{g.V3(0, 0, 0)}
+	flock.AddObstacle(points)
+	flock.AddObstacle(&points)
+	if flock.RemoveObstacle(points) || !flock.RemoveObstacle(&points) || len(flock.Obstacles) != 1 {
+		t.Errorf("remove of non-comparable obstacle failed")
+	}
+}
+
+// pointsObstacle is an obstacle of a non-comparable type.
+type pointsObstacle []g.Vec3
+
+func (points pointsObstacle) Distance(p g.Vec3) (float32, g.Vec3) {
+	return 1, g.V3(0, 1, 0)
+}
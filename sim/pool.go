@@ -0,0 +1,59 @@
+package sim
+
+import "sync"
+
+// task is a parallel loop body, split into phases.
+// Each phase is called once for every tid in [0, threads).
+type task interface {
+	runTask(phase, tid, threads int)
+}
+
+// pool runs tasks on long-lived goroutines.
+//
+// Spawning goroutines with closures allocates on every call,
+// which adds up when done multiple times per frame.
+type pool struct {
+	wake []chan struct{}
+	wg   sync.WaitGroup
+
+	task    task
+	phase   int
+	threads int
+}
+
+// run calls t.runTask for each tid and waits for them to complete.
+// The calling goroutine runs tid 0.
+func (pool *pool) run(threads int, t task, phase int) {
+	if threads < 1 {
+		threads = 1
+	}
+	for len(pool.wake) < threads-1 {
+		wake := make(chan struct{})
+		pool.wake = append(pool.wake, wake)
+		go pool.worker(len(pool.wake), wake)
+	}
+
+	pool.task, pool.phase, pool.threads = t, phase, threads
+	pool.wg.Add(threads - 1)
+	for _, wake := range pool.wake[:threads-1] {
+		wake <- struct{}{}
+	}
+	t.runTask(phase, 0, threads)
+	pool.wg.Wait()
+	pool.task = nil
+}
+
+func (pool *pool) worker(tid int, wake chan struct{}) {
+	for range wake {
+		pool.task.runTask(pool.phase, tid, pool.threads)
+		pool.wg.Done()
+	}
+}
+
+// close stops the worker goroutines.
+func (pool *pool) close() {
+	for _, wake := range pool.wake {
+		close(wake)
+	}
+	pool.wake = nil
+}
@@ -0,0 +1,138 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/adinfinit/g"
+)
+
+// Predator hunts the boids, boids within Settings.PanicRadius flee from it.
+type Predator struct {
+	Position g.Vec3
+	Heading  g.Vec3
+	// Manual predators are moved by the caller instead of chasing boids.
+	Manual bool
+}
+
+// maxPredatorSight limits how many cells a predator looks through on each axis.
+const maxPredatorSight = 8
+
+// AddPredator adds a predator to the world.
+func (flock *Flock) AddPredator(predator Predator) {
+	flock.Predators = append(flock.Predators, predator)
+}
+
+// RemovePredator removes the i-th predator.
+func (flock *Flock) RemovePredator(i int) {
+	flock.Predators = append(flock.Predators[:i], flock.Predators[i+1:]...)
+}
+
+// SpawnPredators adds n chasing predators at random positions.
+func (flock *Flock) SpawnPredators(n int) {
+	for ; n > 0; n-- {
+		flock.AddPredator(flock.randomPredator())
+	}
+}
+
+// randomPredator returns a predator at a random position.
+func (flock *Flock) randomPredator() Predator {
+	return Predator{
+		Position: g.V3(
+			flock.rng.Float32()*40-20,
+			flock.rng.Float32()*40-20,
+			flock.rng.Float32()*40-20,
+		),
+		Heading: g.V3(
+			flock.rng.Float32()-0.5,
+			flock.rng.Float32()-0.5,
+			flock.rng.Float32()-0.5,
+		).Normalize(),
+	}
+}
+
+// chase moves predators towards the densest cell within Settings.PredatorSight,
+// or towards the nearest target when there are no boids in sight.
+func (flock *Flock) chase(dt float32) {
+	flock.updateSubsteps(dt)
+	for i := range flock.Predators {
+		predator := &flock.Predators[i]
+		if predator.Manual {
+			continue
+		}
+
+		prey, ok := flock.densestCell(predator.Position)
+		if !ok {
+			var weight float32
+			prey, weight = flock.nearestTarget(predator.Position)
+			if weight == 0 {
+				prey = predator.Position.Add(predator.Heading)
+			}
+		}
+
+		for step := 0; step < flock.substeps; step++ {
+			head := predator.Heading
+			desired := safeNormalize(prey.Sub(predator.Position), 1)
+			head = safeNormalize(head.Add(desired.Sub(head).Mul(flock.dt)), 1)
+			pos := predator.Position.Add(head.Mul(flock.dt * flock.Settings.PredatorSpeed))
+			predator.Position, predator.Heading = flock.confine(pos, head)
+		}
+	}
+}
+
+// densestCell returns the center of the cell with the most boids within sight of pos.
+func (flock *Flock) densestCell(pos g.Vec3) (center g.Vec3, ok bool) {
+	radius := flock.radius
+	sight := flock.Settings.PredatorSight
+	if sight <= 0 {
+		return g.Vec3{}, false
+	}
+	k := int32(math.Ceil(float64(sight / radius)))
+	if k > maxPredatorSight {
+		k = maxPredatorSight
+	}
+
+	best := 0
+	cell := cellOf(pos, 1/radius)
+	for dz := -k; dz <= k; dz++ {
+		for dy := -k; dy <= k; dy++ {
+			for dx := -k; dx <= k; dx++ {
+				boids := flock.Grid.Lookup(cell.Offset(dx, dy, dz))
+				if len(boids) <= best {
+					continue
+				}
+				cellCenter := flock.CellSeparation[flock.CellIndex[boids[0]]]
+				if cellCenter.Sub(pos).Len2() > sight*sight {
+					continue
+				}
+				best, center = len(boids), cellCenter
+			}
+		}
+	}
+	return center, best > 0
+}
+
+// threat returns the nearest predator within Settings.PanicRadius of pos,
+// the panic level grows from 0 to 1 as the predator gets closer.
+func (flock *Flock) threat(pos g.Vec3) (predator g.Vec3, level float32) {
+	radius := flock.Settings.PanicRadius
+	nearestDistance2 := radius * radius
+	for i := range flock.Predators {
+		p := flock.Predators[i].Position
+		if dist2 := pos.Sub(p).Len2(); dist2 < nearestDistance2 {
+			predator, nearestDistance2 = p, dist2
+			level = 1 - g.Sqrt(dist2)/radius
+		}
+	}
+	return predator, level
+}
+
+// Flee steers away from the nearest predator, weighted by Settings.FleeWeight
+// and how close the predator is.
+type Flee struct{}
+
+func (Flee) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	if near.Panic == 0 {
+		return g.Vec3{}, 0
+	}
+	return boid.Position.Sub(near.Predator), flock.Settings.FleeWeight * near.Panic
+}
@@ -0,0 +1,62 @@
+package sim
+
+import (
+	"math"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestFlee(t *testing.T) {
+	flock := NewFlock(2000, 1)
+	defer flock.Close()
+	flock.EnableBehavior("target", false)
+	flock.AddPredator(Predator{Heading: g.V3(0, 0, 1), Manual: true})
+
+	nearby := func() (n int) {
+		for _, pos := range flock.Position {
+			if pos.Len() < flock.Settings.PanicRadius*0.5 {
+				n++
+			}
+		}
+		return n
+	}
+
+	before := nearby()
+	for i := 0; i < 60; i++ {
+		flock.Step(1.0 / 30.0)
+	}
+	if after := nearby(); after*2 > before {
+		t.Errorf("boids did not flee, %d close before and %d after", before, after)
+	}
+	if flock.Predators[0].Position != (g.Vec3{}) {
+		t.Errorf("manual predator moved")
+	}
+}
+
+func TestChase(t *testing.T) {
+	flock := NewFlock(2000, 1)
+	defer flock.Close()
+	flock.AddPredator(Predator{Position: g.V3(30, 0, 0), Heading: g.V3(-1, 0, 0)})
+
+	nearest := func() float32 {
+		distance := float32(math.MaxFloat32)
+		for _, pos := range flock.Position {
+			distance = g.Min(distance, pos.Sub(flock.Predators[0].Position).Len())
+		}
+		return distance
+	}
+
+	before := nearest()
+	for i := 0; i < 30; i++ {
+		flock.Step(1.0 / 30.0)
+	}
+	if after := nearest(); after >= before {
+		t.Errorf("predator did not approach, %v before and %v after", before, after)
+	}
+
+	flock.RemovePredator(0)
+	if len(flock.Predators) != 0 {
+		t.Errorf("remove failed")
+	}
+}
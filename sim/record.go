@@ -0,0 +1,224 @@
+package sim
+
+import (
+	"bufio"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/adinfinit/g"
+)
+
+type RecordFormat int
+
+const (
+	RecordCSV RecordFormat = iota
+	RecordNDJSON
+)
+
+// Recorder writes boid trajectories to a stream.
+//
+// Record copies the state of the flock and the formatting and
+// writing happens in a separate goroutine. NaN and Inf values are
+// written as null in NDJSON.
+type Recorder struct {
+	Format RecordFormat
+	// Every records only every n-th frame.
+	Every int
+	// Indices of recorded boids, nil records all of them.
+	Indices []int32
+	// Drop skips frames while the writer is behind,
+	// otherwise Record waits for it.
+	Drop bool
+	// Dropped is the number of skipped frames.
+	Dropped int
+
+	w      *bufio.Writer
+	frames chan *recordFrame
+	free   chan *recordFrame
+	done   chan error
+	header bool
+}
+
+type recordFrame struct {
+	frame    int
+	time     float64
+	index    []int32
+	position []g.Vec3
+	heading  []g.Vec3
+	speed    []float32
+}
+
+const recordQueue = 4
+
+func NewRecorder(w io.Writer, format RecordFormat, every int, indices []int32) *Recorder {
+	if every < 1 {
+		every = 1
+	}
+	rec := &Recorder{
+		Format:  format,
+		Every:   every,
+		Indices: indices,
+
+		w:      bufio.NewWriterSize(w, 1<<20),
+		frames: make(chan *recordFrame, recordQueue),
+		free:   make(chan *recordFrame, recordQueue+1),
+		done:   make(chan error, 1),
+	}
+	for i := 0; i < recordQueue+1; i++ {
+		rec.free <- &recordFrame{}
+	}
+	go rec.run()
+	return rec
+}
+
+// SampleIndices picks n distinct boid indices out of count in ascending order.
+func SampleIndices(count, n int, seed int64) []int32 {
+	if n >= count {
+		n = count
+	}
+	rng := rand.New(rand.NewSource(seed))
+	perm := rng.Perm(count)[:n]
+	sort.Ints(perm)
+
+	indices := make([]int32, n)
+	for i, index := range perm {
+		indices[i] = int32(index)
+	}
+	return indices
+}
+
+// Record queues the current flock state when the frame should be recorded.
+//
+// When recordQueue frames are waiting to be written, Record blocks until
+// one of them is written, or skips the frame when Drop is set.
+func (rec *Recorder) Record(flock *Flock) {
+	if flock.Frame%rec.Every != 0 {
+		return
+	}
+
+	var frame *recordFrame
+	if rec.Drop {
+		select {
+		case frame = <-rec.free:
+		default:
+			rec.Dropped++
+			return
+		}
+	} else {
+		frame = <-rec.free
+	}
+	frame.frame = flock.Frame
+	frame.time = flock.Time
+	frame.index = frame.index[:0]
+	frame.position = frame.position[:0]
+	frame.heading = frame.heading[:0]
+	frame.speed = frame.speed[:0]
+
+	if rec.Indices == nil {
+		for i := range flock.Position {
+			frame.index = append(frame.index, int32(i))
+		}
+		frame.position = append(frame.position, flock.Position...)
+		frame.heading = append(frame.heading, flock.Heading...)
+		frame.speed = append(frame.speed, flock.Speed...)
+	} else {
+		for _, i := range rec.Indices {
+			if int(i) >= flock.Count() {
+				continue
+			}
+			frame.index = append(frame.index, i)
+			frame.position = append(frame.position, flock.Position[i])
+			frame.heading = append(frame.heading, flock.Heading[i])
+			frame.speed = append(frame.speed, flock.Speed[i])
+		}
+	}
+
+	rec.frames <- frame
+}
+
+// Close writes pending frames and stops the recorder.
+// It does not close the underlying writer.
+func (rec *Recorder) Close() error {
+	close(rec.frames)
+	return <-rec.done
+}
+
+func (rec *Recorder) run() {
+	var err error
+	line := make([]byte, 0, 256)
+	for frame := range rec.frames {
+		if err == nil {
+			if rec.Format == RecordCSV && !rec.header {
+				rec.header = true
+				_, err = rec.w.WriteString("frame,time,index,px,py,pz,hx,hy,hz,speed\n")
+			}
+			for i := range frame.index {
+				if err != nil {
+					break
+				}
+				line = rec.appendRow(line[:0], frame, i)
+				_, err = rec.w.Write(line)
+			}
+		}
+		rec.free <- frame
+	}
+	if err == nil {
+		err = rec.w.Flush()
+	}
+	rec.done <- err
+}
+
+func (rec *Recorder) appendRow(b []byte, frame *recordFrame, i int) []byte {
+	p, h := frame.position[i], frame.heading[i]
+	json := rec.Format == RecordNDJSON
+
+	switch rec.Format {
+	case RecordNDJSON:
+		b = append(b, `{"frame":`...)
+		b = strconv.AppendInt(b, int64(frame.frame), 10)
+		b = append(b, `,"time":`...)
+		b = strconv.AppendFloat(b, frame.time, 'g', -1, 64)
+		b = append(b, `,"index":`...)
+		b = strconv.AppendInt(b, int64(frame.index[i]), 10)
+		b = append(b, `,"position":[`...)
+		b = appendVec3(b, p, json)
+		b = append(b, `],"heading":[`...)
+		b = appendVec3(b, h, json)
+		b = append(b, `],"speed":`...)
+		b = appendFloat32(b, frame.speed[i], json)
+		b = append(b, "}\n"...)
+	default:
+		b = strconv.AppendInt(b, int64(frame.frame), 10)
+		b = append(b, ',')
+		b = strconv.AppendFloat(b, frame.time, 'g', -1, 64)
+		b = append(b, ',')
+		b = strconv.AppendInt(b, int64(frame.index[i]), 10)
+		b = append(b, ',')
+		b = appendVec3(b, p, json)
+		b = append(b, ',')
+		b = appendVec3(b, h, json)
+		b = append(b, ',')
+		b = appendFloat32(b, frame.speed[i], json)
+		b = append(b, '\n')
+	}
+	return b
+}
+
+// appendFloat32 appends v, JSON has no NaN and Inf so they are written as null.
+func appendFloat32(b []byte, v float32, json bool) []byte {
+	if json && !finite32(v) {
+		return append(b, "null"...)
+	}
+	return strconv.AppendFloat(b, float64(v), 'g', -1, 32)
+}
+
+func appendVec3(b []byte, v g.Vec3, json bool) []byte {
+	b = appendFloat32(b, v.X, json)
+	b = append(b, ',')
+	b = appendFloat32(b, v.Y, json)
+	b = append(b, ',')
+	b = appendFloat32(b, v.Z, json)
+	return b
+}
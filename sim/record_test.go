@@ -0,0 +1,135 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestRecordCSV(t *testing.T) {
+	flock := NewFlock(5, 1)
+	defer flock.Close()
+
+	var buf bytes.Buffer
+	flock.Recorder = NewRecorder(&buf, RecordCSV, 2, nil)
+	for i := 0; i < 4; i++ {
+		flock.Step(1.0 / 60)
+	}
+	if err := flock.Recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1+2*5 || rows[0][0] != "frame" || len(rows[0]) != 10 {
+		t.Fatalf("got %d rows, header %v", len(rows), rows[0])
+	}
+	for k, row := range rows[1:] {
+		frame, index := 2+k/5*2, k%5
+		if row[0] != strconv.Itoa(frame) || row[2] != strconv.Itoa(index) {
+			t.Fatalf("row %d is frame %s boid %s, expected %d %d", k, row[0], row[2], frame, index)
+		}
+	}
+	// the last frame is the current state
+	for i, row := range rows[len(rows)-5:] {
+		x, _ := strconv.ParseFloat(row[3], 32)
+		speed, _ := strconv.ParseFloat(row[9], 32)
+		if float32(x) != flock.Position[i].X || float32(speed) != flock.Speed[i] {
+			t.Errorf("boid %d recorded %v %v, expected %v %v", i, x, speed, flock.Position[i].X, flock.Speed[i])
+		}
+	}
+}
+
+func TestRecordNDJSON(t *testing.T) {
+	flock := NewFlock(5, 1)
+	defer flock.Close()
+
+	var buf bytes.Buffer
+	rec := NewRecorder(&buf, RecordNDJSON, 1, []int32{1, 3, 99})
+	flock.Position[3] = g.V3(float32(math.NaN()), float32(math.Inf(1)), 2)
+	rec.Record(flock)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	type row struct {
+		Frame    int
+		Index    int32
+		Position []*float32
+		Heading  []*float32
+		Speed    *float32
+	}
+	var rows []row
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var r row
+		if err := decoder.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r)
+	}
+	if len(rows) != 2 || rows[0].Index != 1 || rows[1].Index != 3 {
+		t.Fatalf("got rows %+v", rows)
+	}
+	if p := rows[0].Position; len(p) != 3 || *p[0] != flock.Position[1].X {
+		t.Errorf("got position %v, expected %v", p, flock.Position[1])
+	}
+	if p := rows[1].Position; p[0] != nil || p[1] != nil || p[2] == nil || *p[2] != 2 {
+		t.Errorf("expected NaN and Inf as null, got %v", p)
+	}
+}
+
+// failWriter fails every write.
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, errFail }
+
+var errFail = errors.New("fail")
+
+// blockWriter blocks writes until release is closed.
+type blockWriter struct{ release chan struct{} }
+
+func (w blockWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+func TestRecordClose(t *testing.T) {
+	flock := NewFlock(5, 1)
+	defer flock.Close()
+
+	rec := NewRecorder(failWriter{}, RecordCSV, 1, nil)
+	rec.Record(flock)
+	if err := rec.Close(); !errors.Is(err, errFail) {
+		t.Fatalf("expected write error, got %v", err)
+	}
+}
+
+func TestRecordDrop(t *testing.T) {
+	// a frame larger than the write buffer blocks the writer
+	flock := NewFlock(20000, 1)
+	defer flock.Close()
+
+	writer := blockWriter{release: make(chan struct{})}
+	rec := NewRecorder(writer, RecordCSV, 1, nil)
+	rec.Drop = true
+	for i := 0; i < recordQueue+3; i++ {
+		flock.Frame = i
+		rec.Record(flock)
+	}
+	if rec.Dropped != 2 {
+		t.Errorf("dropped %d frames, expected 2", rec.Dropped)
+	}
+	close(writer.release)
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
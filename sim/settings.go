@@ -0,0 +1,134 @@
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Validate checks that the settings can be used for simulation,
+// it reports all invalid settings at once.
+func (settings *Settings) Validate() error {
+	// the arguments are only formatted on failure,
+	// so that validating animated settings in Step does not allocate
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	finite := func(name string, v float32) {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			fail("%s must be finite, got %v", name, v)
+		}
+	}
+	nonNegative := func(name string, v float32) {
+		finite(name, v)
+		if v < 0 {
+			fail("%s must not be negative, got %v", name, v)
+		}
+	}
+
+	if settings.Mode != CellAverage && settings.Mode != Neighborhood {
+		fail("unknown mode %d", settings.Mode)
+	}
+	finite("CellRadius", settings.CellRadius)
+	nonNegative("CellRadiusWobble", settings.CellRadiusWobble)
+	if !(settings.CellRadius-settings.CellRadiusWobble > 0) {
+		fail("CellRadius must be larger than CellRadiusWobble, got %v and %v", settings.CellRadius, settings.CellRadiusWobble)
+	}
+	if settings.MaxNeighbors < 0 {
+		fail("MaxNeighbors must not be negative, got %v", settings.MaxNeighbors)
+	}
+
+	finite("SeparationWeight", settings.SeparationWeight)
+	finite("AlignmentWeight", settings.AlignmentWeight)
+	finite("CohesionWeight", settings.CohesionWeight)
+	finite("TargetWeight", settings.TargetWeight)
+	if !(settings.TargetBlend >= 0) {
+		fail("TargetBlend must not be negative, got %v", settings.TargetBlend)
+	}
+
+	finite("AvoidanceWeight", settings.AvoidanceWeight)
+	nonNegative("AvoidanceDistance", settings.AvoidanceDistance)
+
+	if settings.Bounds < Unbounded || settings.Bounds > Soft {
+		fail("unknown bounds mode %d", settings.Bounds)
+	}
+	if settings.BoundsShape != BoxBounds && settings.BoundsShape != SphereBounds {
+		fail("unknown bounds shape %d", settings.BoundsShape)
+	}
+	nonNegative("BoundsSize", settings.BoundsSize)
+	finite("BoundsWeight", settings.BoundsWeight)
+
+	nonNegative("PanicRadius", settings.PanicRadius)
+	finite("FleeWeight", settings.FleeWeight)
+	nonNegative("PredatorSpeed", settings.PredatorSpeed)
+	nonNegative("PredatorSight", settings.PredatorSight)
+	finite("SpeciesAvoidWeight", settings.SpeciesAvoidWeight)
+
+	nonNegative("MinSpeed", settings.MinSpeed)
+	nonNegative("MaxSpeed", settings.MaxSpeed)
+	if !(settings.MaxSpeed == 0 || settings.MaxSpeed >= settings.MinSpeed) {
+		fail("MaxSpeed must not be less than MinSpeed, got %v and %v", settings.MaxSpeed, settings.MinSpeed)
+	}
+	nonNegative("MaxAcceleration", settings.MaxAcceleration)
+	nonNegative("MaxTurnRate", settings.MaxTurnRate)
+	nonNegative("Drag", settings.Drag)
+
+	if settings.Integrator < ExplicitEuler || settings.Integrator > RK4 {
+		fail("unknown integrator %d", settings.Integrator)
+	}
+	nonNegative("MaxStep", settings.MaxStep)
+	if settings.MaxSubsteps < 0 {
+		fail("MaxSubsteps must not be negative, got %v", settings.MaxSubsteps)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (mode Mode) MarshalText() ([]byte, error) { return []byte(mode.String()), nil }
+
+func (mode *Mode) UnmarshalText(text []byte) error {
+	for _, m := range []Mode{CellAverage, Neighborhood} {
+		if string(text) == m.String() {
+			*mode = m
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mode %q", text)
+}
+
+func (mode BoundsMode) MarshalText() ([]byte, error) { return []byte(mode.String()), nil }
+
+func (mode *BoundsMode) UnmarshalText(text []byte) error {
+	for _, m := range []BoundsMode{Unbounded, Wrap, Bounce, Soft} {
+		if string(text) == m.String() {
+			*mode = m
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown bounds mode %q", text)
+}
+
+func (shape BoundsShape) MarshalText() ([]byte, error) { return []byte(shape.String()), nil }
+
+func (shape *BoundsShape) UnmarshalText(text []byte) error {
+	for _, s := range []BoundsShape{BoxBounds, SphereBounds} {
+		if string(text) == s.String() {
+			*shape = s
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown bounds shape %q", text)
+}
+
+func (integrator Integrator) MarshalText() ([]byte, error) { return []byte(integrator.String()), nil }
+
+func (integrator *Integrator) UnmarshalText(text []byte) error {
+	for _, i := range []Integrator{ExplicitEuler, SemiImplicitEuler, Verlet, RK4} {
+		if string(text) == i.String() {
+			*integrator = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown integrator %q", text)
+}
@@ -0,0 +1,61 @@
+package sim
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSettingsValidate(t *testing.T) {
+	flock := NewFlock(0, 1)
+	defer flock.Close()
+
+	if err := flock.Settings.Validate(); err != nil {
+		t.Fatalf("default settings are invalid: %v", err)
+	}
+
+	settings := flock.Settings
+	settings.CellRadius = 1
+	settings.Drag = float32(math.NaN())
+	settings.MinSpeed = 10
+	settings.MaxSpeed = 5
+	err := settings.Validate()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, name := range []string{"CellRadiusWobble", "Drag", "MaxSpeed"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention %v: %v", name, err)
+		}
+	}
+}
+
+func TestSettingsJSON(t *testing.T) {
+	flock := NewFlock(0, 1)
+	defer flock.Close()
+
+	flock.Settings.Mode = Neighborhood
+	flock.Settings.Bounds = Soft
+	flock.Settings.BoundsShape = SphereBounds
+
+	data, err := json.Marshal(&flock.Settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Mode":"neighborhood"`) || !strings.Contains(string(data), `"Bounds":"soft"`) {
+		t.Errorf("modes are not readable: %s", data)
+	}
+
+	var settings Settings
+	if err := json.Unmarshal(data, &settings); err != nil {
+		t.Fatal(err)
+	}
+	if settings != flock.Settings {
+		t.Errorf("got %+v, expected %+v", settings, flock.Settings)
+	}
+
+	if err := json.Unmarshal([]byte(`{"BoundsShape": "torus"}`), &settings); err == nil {
+		t.Errorf("expected error for unknown shape")
+	}
+}
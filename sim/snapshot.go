@@ -0,0 +1,767 @@
+package sim
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/adinfinit/g"
+)
+
+// Snapshot layout, all values are little-endian:
+//
+//	magic   [4]byte "BOID"
+//	version uint32
+//	flags   uint32
+//	payload, gzip compressed when flags has snapshotGzip:
+//	    settings uint32 + bytes, JSON encoded Settings
+//	    time     float64
+//	    frame    uint64
+//	    rng      uint64, state of the random source
+//	    targets  uint32 + targets * (position [3]float32, weight float32, radius float32,
+//	             falloff uint32, repel uint32, path)
+//	    count    uint32
+//	    position count * [3]float32
+//	    heading  count * [3]float32
+//	    speed    count * float32
+//	    predators uint32 + predators * (position [3]float32, heading [3]float32, manual uint32)
+//	    species  uint32 + species * (name uint32 + bytes, weights [4]float32,
+//	             speeds [2]float32, size float32, color [4]float32, count uint32)
+//	    interactions species * species * uint8
+//	    obstacles uint32 + obstacles * obstacle
+//	    fields   uint32 + fields * field
+//	    behaviors uint32 + behaviors * (name uint32 + bytes, enabled uint32)
+//	    crc32    uint32, IEEE checksum of the header and the preceding payload
+//
+// Settings are stored as JSON, so that settings added later keep
+// their current value when an older snapshot is loaded.
+//
+// Lists are read in chunks, so that a corrupt count fails at the end
+// of the data instead of allocating memory for it upfront.
+//
+// A path starts with its kind uint32 followed by its fields, see encodePath.
+// Paths of other types, such as PathFunc, are saved as pathNone.
+// Obstacles and fields are saved the same way, but saving fails for
+// types outside of this package. Behaviors are not saved, only whether
+// they are enabled, so they must be registered before loading.
+const (
+	snapshotMagic   = "BOID"
+	SnapshotVersion = 1
+
+	snapshotGzip = 1 << 0
+
+	maxSnapshotCount = 1 << 28
+	// snapshotChunk is the number of list elements allocated at a time while reading.
+	snapshotChunk = 1 << 16
+)
+
+var ErrSnapshotChecksum = errors.New("snapshot checksum mismatch")
+
+// Save writes the full flock state to w.
+func (flock *Flock) Save(w io.Writer) error { return flock.save(w, false) }
+
+// SaveCompressed writes the full flock state to w using gzip compression.
+func (flock *Flock) SaveCompressed(w io.Writer) error { return flock.save(w, true) }
+
+func (flock *Flock) save(w io.Writer, compress bool) error {
+	var flags uint32
+	if compress {
+		flags |= snapshotGzip
+	}
+
+	header := make([]byte, 0, 12)
+	header = append(header, snapshotMagic...)
+	header = binary.LittleEndian.AppendUint32(header, SnapshotVersion)
+	header = binary.LittleEndian.AppendUint32(header, flags)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	var payload io.Writer = w
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(w)
+		payload = zw
+	}
+
+	enc := newEncoder(payload)
+	enc.crc.Write(header)
+	settings, err := json.Marshal(&flock.Settings)
+	if err != nil {
+		return fmt.Errorf("unable to encode settings: %w", err)
+	}
+	enc.str(string(settings))
+	enc.f64(flock.Time)
+	enc.u64(uint64(flock.Frame))
+	enc.u64(flock.source.state)
+
+	enc.u32(uint32(len(flock.Targets)))
+	for _, target := range flock.Targets {
+		enc.vec3(target.Position)
+		enc.f32(target.Weight)
+		enc.f32(target.Radius)
+		enc.u32(uint32(target.Falloff))
+		repel := uint32(0)
+		if target.Repel {
+			repel = 1
+		}
+		enc.u32(repel)
+		enc.path(target.Path)
+	}
+
+	enc.u32(uint32(flock.Count()))
+	for _, p := range flock.Position {
+		enc.vec3(p)
+	}
+	for _, h := range flock.Heading {
+		enc.vec3(h)
+	}
+	for _, s := range flock.Speed {
+		enc.f32(s)
+	}
+
+	enc.u32(uint32(len(flock.Predators)))
+	for _, predator := range flock.Predators {
+		enc.vec3(predator.Position)
+		enc.vec3(predator.Heading)
+		manual := uint32(0)
+		if predator.Manual {
+			manual = 1
+		}
+		enc.u32(manual)
+	}
+
+	enc.u32(uint32(len(flock.Species)))
+	for k, species := range flock.Species {
+		enc.str(species.Name)
+		enc.f32(species.Separation)
+		enc.f32(species.Alignment)
+		enc.f32(species.Cohesion)
+		enc.f32(species.Target)
+		enc.f32(species.MinSpeed)
+		enc.f32(species.MaxSpeed)
+		enc.f32(species.Size)
+		enc.vec4(species.Color)
+		start, limit := flock.SpeciesRange(k)
+		enc.u32(uint32(limit - start))
+	}
+	for _, interaction := range flock.interactions {
+		enc.buf[0] = byte(interaction)
+		enc.Write(enc.buf[:1])
+	}
+
+	enc.u32(uint32(len(flock.Obstacles)))
+	for _, obstacle := range flock.Obstacles {
+		enc.obstacle(obstacle)
+	}
+	enc.u32(uint32(len(flock.Fields)))
+	for _, field := range flock.Fields {
+		enc.field(field)
+	}
+	enc.u32(uint32(len(flock.Behaviors)))
+	for _, behavior := range flock.Behaviors {
+		enc.str(behavior.Name)
+		enabled := uint32(0)
+		if behavior.Enabled {
+			enabled = 1
+		}
+		enc.u32(enabled)
+	}
+	if err := enc.finish(); err != nil {
+		return err
+	}
+
+	if zw != nil {
+		return zw.Close()
+	}
+	return nil
+}
+
+// Load replaces the flock state with a snapshot read from r.
+// The flock is left unmodified when the snapshot is invalid,
+// including values that could not have been saved, such as invalid settings.
+func (flock *Flock) Load(r io.Reader) error {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return fmt.Errorf("unable to read snapshot header: %w", err)
+	}
+	if string(header[:4]) != snapshotMagic {
+		return errors.New("not a snapshot")
+	}
+	version := binary.LittleEndian.Uint32(header[4:])
+	if version != SnapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	flags := binary.LittleEndian.Uint32(header[8:])
+
+	var payload io.Reader = r
+	if flags&snapshotGzip != 0 {
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("unable to decompress snapshot: %w", err)
+		}
+		defer zr.Close()
+		payload = zr
+	}
+
+	dec := newDecoder(payload)
+	dec.crc.Write(header)
+
+	settingsJSON := dec.str()
+	time := dec.f64()
+	frame := int(dec.u64())
+	source := splitMix{state: dec.u64()}
+
+	targets := readList(dec, dec.count(), func() Target {
+		return Target{
+			Position: dec.vec3(),
+			Weight:   dec.f32(),
+			Radius:   dec.f32(),
+			Falloff:  Falloff(dec.u32()),
+			Repel:    dec.u32() != 0,
+			Path:     dec.path(),
+		}
+	})
+
+	count := dec.count()
+	position := readList(dec, count, dec.vec3)
+	heading := readList(dec, count, dec.vec3)
+	speed := readList(dec, count, dec.f32)
+
+	predators := readList(dec, dec.count(), func() Predator {
+		return Predator{Position: dec.vec3(), Heading: dec.vec3(), Manual: dec.u32() != 0}
+	})
+
+	speciesStart := []int{0}
+	species := readList(dec, dec.count(), func() Species {
+		species := Species{
+			Name:       dec.str(),
+			Separation: dec.f32(),
+			Alignment:  dec.f32(),
+			Cohesion:   dec.f32(),
+			Target:     dec.f32(),
+			MinSpeed:   dec.f32(),
+			MaxSpeed:   dec.f32(),
+			Size:       dec.f32(),
+			Color:      dec.vec4(),
+		}
+		speciesStart = append(speciesStart, speciesStart[len(speciesStart)-1]+dec.count())
+		return species
+	})
+	interactions := readList(dec, len(species)*len(species), func() Interaction {
+		dec.Read(dec.buf[:1])
+		return Interaction(dec.buf[0])
+	})
+
+	obstacles := readList(dec, dec.count(), dec.obstacle)
+	fields := readList(dec, dec.count(), dec.field)
+	type behaviorState struct {
+		name    string
+		enabled bool
+	}
+	behaviors := readList(dec, dec.count(), func() behaviorState {
+		return behaviorState{name: dec.str(), enabled: dec.u32() != 0}
+	})
+	if err := dec.finish(); err != nil {
+		return err
+	}
+
+	enabled := make([]bool, len(flock.Behaviors))
+	for k := range flock.Behaviors {
+		enabled[k] = flock.Behaviors[k].Enabled
+	}
+	for _, behavior := range behaviors {
+		k := slices.IndexFunc(flock.Behaviors, func(registered RegisteredBehavior) bool {
+			return registered.Name == behavior.name
+		})
+		if k < 0 {
+			return fmt.Errorf("snapshot behavior %q is not registered", behavior.name)
+		}
+		enabled[k] = behavior.enabled
+	}
+
+	settings := flock.Settings
+	decoder := json.NewDecoder(strings.NewReader(settingsJSON))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&settings); err != nil {
+		return fmt.Errorf("unable to parse snapshot settings: %w", err)
+	}
+	if err := settings.Validate(); err != nil {
+		return fmt.Errorf("invalid snapshot settings: %w", err)
+	}
+	for i := range position {
+		if !finite(position[i]) || !finite(heading[i]) || g.Abs(heading[i].Len()-1) > headingTolerance ||
+			!finite32(speed[i]) || speed[i] < 0 {
+			return fmt.Errorf("invalid snapshot boid %d", i)
+		}
+	}
+	for i, target := range targets {
+		if target.Falloff < ConstantFalloff || target.Falloff > QuadraticFalloff || !finiteValues(target) {
+			return fmt.Errorf("invalid snapshot target %d", i)
+		}
+	}
+	for i, predator := range predators {
+		if !finiteValues(predator) {
+			return fmt.Errorf("invalid snapshot predator %d", i)
+		}
+	}
+	for k := range species {
+		if !finiteValues(species[k]) || species[k].MinSpeed < 0 || species[k].MaxSpeed < 0 {
+			return fmt.Errorf("invalid snapshot species %q", species[k].Name)
+		}
+	}
+	for _, interaction := range interactions {
+		if interaction > Avoid {
+			return fmt.Errorf("unknown snapshot interaction %d", interaction)
+		}
+	}
+	if !finiteValues(obstacles) || !finiteValues(fields) {
+		return errors.New("invalid snapshot obstacles or fields")
+	}
+	if len(species) == 0 || len(species) > MaxSpecies {
+		return fmt.Errorf("invalid snapshot species count %d", len(species))
+	}
+	if speciesStart[len(species)] != count {
+		return errors.New("snapshot species do not match boid count")
+	}
+
+	speciesIndex := make([]uint8, count)
+	for k := range species {
+		for i := speciesStart[k]; i < speciesStart[k+1]; i++ {
+			speciesIndex[i] = uint8(k)
+		}
+	}
+
+	flock.Settings = settings
+	flock.Time = time
+	flock.Frame = frame
+	flock.source = source
+	flock.Targets = targets
+	flock.Position = position
+	flock.Heading = heading
+	flock.Speed = speed
+	flock.Predators = predators
+	flock.Species = species
+	flock.SpeciesIndex = speciesIndex
+	flock.speciesStart = speciesStart
+	flock.interactions = interactions
+	flock.Obstacles = obstacles
+	flock.Fields = fields
+	for k := range flock.Behaviors {
+		flock.Behaviors[k].Enabled = enabled[k]
+	}
+	flock.CellIndex = make([]int32, count)
+
+	return nil
+}
+
+const (
+	pathNone = iota
+	pathCircle
+	pathLissajous
+	pathWaypoints
+	pathSpline
+	pathKeyframes
+)
+
+func (enc *encoder) path(path Path) {
+	switch path := path.(type) {
+	case *Circle:
+		enc.u32(pathCircle)
+		enc.vec3(path.Center)
+		enc.vec3(path.U)
+		enc.vec3(path.V)
+		enc.f32(path.Speed)
+		enc.f32(path.Phase)
+	case *Lissajous:
+		enc.u32(pathLissajous)
+		enc.vec3(path.Center)
+		enc.vec3(path.Amplitude)
+		enc.vec3(path.Frequency)
+		enc.vec3(path.Phase)
+	case *Waypoints:
+		enc.u32(pathWaypoints)
+		enc.points(path.Points)
+		enc.f32(path.Duration)
+	case *Spline:
+		enc.u32(pathSpline)
+		enc.points(path.Points)
+		enc.f32(path.Duration)
+	case *Keyframes:
+		enc.u32(pathKeyframes)
+		enc.u32(uint32(len(path.Keys)))
+		for _, key := range path.Keys {
+			enc.f32(key.Time)
+			enc.vec3(key.Position)
+		}
+		loop := uint32(0)
+		if path.Loop {
+			loop = 1
+		}
+		enc.u32(loop)
+	default:
+		enc.u32(pathNone)
+	}
+}
+
+const (
+	obstacleSphere = iota + 1
+	obstacleBox
+	obstaclePlane
+	obstacleCapsule
+)
+
+func (enc *encoder) obstacle(obstacle Obstacle) {
+	switch obstacle := obstacle.(type) {
+	case *Sphere:
+		enc.u32(obstacleSphere)
+		enc.vec3(obstacle.Center)
+		enc.f32(obstacle.Radius)
+	case *Box:
+		enc.u32(obstacleBox)
+		enc.vec3(obstacle.Min)
+		enc.vec3(obstacle.Max)
+	case *Plane:
+		enc.u32(obstaclePlane)
+		enc.vec3(obstacle.Point)
+		enc.vec3(obstacle.Normal)
+	case *Capsule:
+		enc.u32(obstacleCapsule)
+		enc.vec3(obstacle.A)
+		enc.vec3(obstacle.B)
+		enc.f32(obstacle.Radius)
+	default:
+		if enc.err == nil {
+			enc.err = fmt.Errorf("unable to save obstacle of type %T", obstacle)
+		}
+	}
+}
+
+func (dec *decoder) obstacle() Obstacle {
+	switch kind := dec.u32(); kind {
+	case obstacleSphere:
+		return &Sphere{Center: dec.vec3(), Radius: dec.f32()}
+	case obstacleBox:
+		return &Box{Min: dec.vec3(), Max: dec.vec3()}
+	case obstaclePlane:
+		return &Plane{Point: dec.vec3(), Normal: dec.vec3()}
+	case obstacleCapsule:
+		return &Capsule{A: dec.vec3(), B: dec.vec3(), Radius: dec.f32()}
+	default:
+		if dec.err == nil {
+			dec.err = fmt.Errorf("unknown snapshot obstacle kind %d", kind)
+		}
+		return nil
+	}
+}
+
+const (
+	fieldWind = iota + 1
+	fieldVortex
+	fieldCurlNoise
+	fieldVectorGrid
+)
+
+func (enc *encoder) field(field Field) {
+	switch field := field.(type) {
+	case *Wind:
+		enc.u32(fieldWind)
+		enc.vec3(field.Velocity)
+		enc.vec3(field.Gust)
+		enc.f32(field.Frequency)
+	case *Vortex:
+		enc.u32(fieldVortex)
+		enc.vec3(field.Center)
+		enc.vec3(field.Axis)
+		enc.f32(field.Radius)
+		enc.f32(field.Strength)
+	case *CurlNoise:
+		enc.u32(fieldCurlNoise)
+		enc.f32(field.Scale)
+		enc.f32(field.Strength)
+		enc.f32(field.Speed)
+		enc.u32(field.Seed)
+	case *VectorGrid:
+		enc.u32(fieldVectorGrid)
+		enc.vec3(field.Origin)
+		enc.f32(field.Spacing)
+		for _, size := range field.Size {
+			enc.u32(uint32(size))
+		}
+		enc.points(field.Velocities)
+	default:
+		if enc.err == nil {
+			enc.err = fmt.Errorf("unable to save field of type %T", field)
+		}
+	}
+}
+
+func (dec *decoder) field() Field {
+	switch kind := dec.u32(); kind {
+	case fieldWind:
+		return &Wind{Velocity: dec.vec3(), Gust: dec.vec3(), Frequency: dec.f32()}
+	case fieldVortex:
+		return &Vortex{Center: dec.vec3(), Axis: dec.vec3(), Radius: dec.f32(), Strength: dec.f32()}
+	case fieldCurlNoise:
+		return &CurlNoise{Scale: dec.f32(), Strength: dec.f32(), Speed: dec.f32(), Seed: dec.u32()}
+	case fieldVectorGrid:
+		grid := &VectorGrid{Origin: dec.vec3(), Spacing: dec.f32()}
+		samples := 1
+		for axis := range grid.Size {
+			grid.Size[axis] = dec.count()
+			samples = min(samples*grid.Size[axis], maxSnapshotCount+1)
+		}
+		grid.Velocities = dec.points()
+		if dec.err == nil && len(grid.Velocities) != samples {
+			dec.err = fmt.Errorf("snapshot vector grid has %d velocities for size %v", len(grid.Velocities), grid.Size)
+		}
+		return grid
+	default:
+		if dec.err == nil {
+			dec.err = fmt.Errorf("unknown snapshot field kind %d", kind)
+		}
+		return nil
+	}
+}
+
+func (enc *encoder) points(points []g.Vec3) {
+	enc.u32(uint32(len(points)))
+	for _, p := range points {
+		enc.vec3(p)
+	}
+}
+
+func (dec *decoder) path() Path {
+	switch kind := dec.u32(); kind {
+	case pathNone:
+		return nil
+	case pathCircle:
+		return &Circle{Center: dec.vec3(), U: dec.vec3(), V: dec.vec3(), Speed: dec.f32(), Phase: dec.f32()}
+	case pathLissajous:
+		return &Lissajous{Center: dec.vec3(), Amplitude: dec.vec3(), Frequency: dec.vec3(), Phase: dec.vec3()}
+	case pathWaypoints:
+		return &Waypoints{Points: dec.points(), Duration: dec.f32()}
+	case pathSpline:
+		return &Spline{Points: dec.points(), Duration: dec.f32()}
+	case pathKeyframes:
+		keys := readList(dec, dec.count(), func() Keyframe {
+			return Keyframe{Time: dec.f32(), Position: dec.vec3()}
+		})
+		return &Keyframes{Keys: keys, Loop: dec.u32() != 0}
+	default:
+		if dec.err == nil {
+			dec.err = fmt.Errorf("unknown snapshot path kind %d", kind)
+		}
+		return nil
+	}
+}
+
+func (dec *decoder) points() []g.Vec3 {
+	return readList(dec, dec.count(), dec.vec3)
+}
+
+// finiteValues returns whether all floats reachable from v are finite.
+func finiteValues(v any) bool {
+	var walk func(v reflect.Value) bool
+	walk = func(v reflect.Value) bool {
+		switch v.Kind() {
+		case reflect.Float32, reflect.Float64:
+			f := v.Float()
+			return !math.IsNaN(f) && !math.IsInf(f, 0)
+		case reflect.Pointer, reflect.Interface:
+			return v.IsNil() || walk(v.Elem())
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if !walk(v.Field(i)) {
+					return false
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				if !walk(v.Index(i)) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return walk(reflect.ValueOf(v))
+}
+
+// readList reads n elements, allocating at most snapshotChunk elements
+// ahead of the data that has been read.
+func readList[T any](dec *decoder, n int, read func() T) []T {
+	list := make([]T, 0, min(n, snapshotChunk))
+	for len(list) < n && dec.err == nil {
+		if len(list) == cap(list) {
+			list = slices.Grow(list, min(n-len(list), snapshotChunk))
+		}
+		list = append(list, read())
+	}
+	return list
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	crc hash.Hash32
+	err error
+	buf [8]byte
+}
+
+func newEncoder(w io.Writer) *encoder {
+	return &encoder{
+		w:   bufio.NewWriter(w),
+		crc: crc32.NewIEEE(),
+	}
+}
+
+func (enc *encoder) Write(data []byte) (int, error) {
+	if enc.err != nil {
+		return 0, enc.err
+	}
+	enc.crc.Write(data)
+	var n int
+	n, enc.err = enc.w.Write(data)
+	return n, enc.err
+}
+
+func (enc *encoder) u32(v uint32) {
+	binary.LittleEndian.PutUint32(enc.buf[:4], v)
+	enc.Write(enc.buf[:4])
+}
+
+func (enc *encoder) u64(v uint64) {
+	binary.LittleEndian.PutUint64(enc.buf[:8], v)
+	enc.Write(enc.buf[:8])
+}
+
+func (enc *encoder) f32(v float32) { enc.u32(math.Float32bits(v)) }
+func (enc *encoder) f64(v float64) { enc.u64(math.Float64bits(v)) }
+
+func (enc *encoder) vec3(v g.Vec3) {
+	enc.f32(v.X)
+	enc.f32(v.Y)
+	enc.f32(v.Z)
+}
+
+func (enc *encoder) vec4(v g.Vec4) {
+	enc.f32(v.X)
+	enc.f32(v.Y)
+	enc.f32(v.Z)
+	enc.f32(v.W)
+}
+
+func (enc *encoder) str(v string) {
+	enc.u32(uint32(len(v)))
+	enc.Write([]byte(v))
+}
+
+// finish writes the checksum and flushes the output.
+func (enc *encoder) finish() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	binary.LittleEndian.PutUint32(enc.buf[:4], enc.crc.Sum32())
+	if _, err := enc.w.Write(enc.buf[:4]); err != nil {
+		return err
+	}
+	return enc.w.Flush()
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+	err error
+	buf [8]byte
+}
+
+func newDecoder(r io.Reader) *decoder {
+	return &decoder{
+		r:   bufio.NewReader(r),
+		crc: crc32.NewIEEE(),
+	}
+}
+
+func (dec *decoder) Read(data []byte) (int, error) {
+	if dec.err != nil {
+		return 0, dec.err
+	}
+	var n int
+	n, dec.err = io.ReadFull(dec.r, data)
+	dec.crc.Write(data[:n])
+	return n, dec.err
+}
+
+func (dec *decoder) u32() uint32 {
+	dec.Read(dec.buf[:4])
+	return binary.LittleEndian.Uint32(dec.buf[:4])
+}
+
+func (dec *decoder) u64() uint64 {
+	dec.Read(dec.buf[:8])
+	return binary.LittleEndian.Uint64(dec.buf[:8])
+}
+
+func (dec *decoder) f32() float32 { return math.Float32frombits(dec.u32()) }
+func (dec *decoder) f64() float64 { return math.Float64frombits(dec.u64()) }
+
+func (dec *decoder) vec3() g.Vec3 {
+	return g.Vec3{X: dec.f32(), Y: dec.f32(), Z: dec.f32()}
+}
+
+func (dec *decoder) vec4() g.Vec4 {
+	return g.Vec4{X: dec.f32(), Y: dec.f32(), Z: dec.f32(), W: dec.f32()}
+}
+
+// maxSnapshotString limits the length of strings, such as species names.
+const maxSnapshotString = 1 << 16
+
+func (dec *decoder) str() string {
+	n := dec.u32()
+	if dec.err == nil && n > maxSnapshotString {
+		dec.err = fmt.Errorf("snapshot string length %d too large", n)
+	}
+	if dec.err != nil {
+		return ""
+	}
+	data := make([]byte, n)
+	dec.Read(data)
+	return string(data)
+}
+
+// count reads a length prefix and guards against huge allocations.
+func (dec *decoder) count() int {
+	n := dec.u32()
+	if dec.err == nil && n > maxSnapshotCount {
+		dec.err = fmt.Errorf("snapshot count %d too large", n)
+	}
+	if dec.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+// finish reads and verifies the checksum.
+func (dec *decoder) finish() error {
+	if dec.err != nil {
+		return fmt.Errorf("unable to read snapshot: %w", dec.err)
+	}
+	expected := dec.crc.Sum32()
+	if _, err := io.ReadFull(dec.r, dec.buf[:4]); err != nil {
+		return fmt.Errorf("unable to read snapshot checksum: %w", err)
+	}
+	if binary.LittleEndian.Uint32(dec.buf[:4]) != expected {
+		return ErrSnapshotChecksum
+	}
+	return nil
+}
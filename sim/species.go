@@ -0,0 +1,203 @@
+package sim
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/adinfinit/g"
+)
+
+// MaxSpecies is the maximum number of species in a flock.
+const MaxSpecies = 16
+
+// Species is a kind of boid with its own weights, speed and look.
+//
+// Boids of a species are stored contiguously, see Flock.SpeciesRange.
+type Species struct {
+	Name string
+
+	// Separation, Alignment, Cohesion and Target scale the Settings weights.
+	Separation float32
+	Alignment  float32
+	Cohesion   float32
+	Target     float32
+
+	// MinSpeed and MaxSpeed is the range of speeds of new boids,
+	// boids keep their speed within it and Settings.MinSpeed and MaxSpeed.
+	// 0 MaxSpeed is unlimited.
+	MinSpeed float32
+	MaxSpeed float32
+
+	// Size and Color are used for rendering,
+	// Color.W mixes Color into the default coloring.
+	Size  float32
+	Color g.Vec4
+}
+
+// DefaultSpecies returns the species used for new flocks.
+func DefaultSpecies() Species {
+	return Species{
+		Name:       "boid",
+		Separation: 1,
+		Alignment:  1,
+		Cohesion:   1,
+		Target:     1,
+		MinSpeed:   5,
+		MaxSpeed:   8,
+		Size:       0.5,
+	}
+}
+
+// Interaction is how boids of one species react to boids of another.
+type Interaction uint8
+
+const (
+	// Flocking treats the other species as its own.
+	Flocking Interaction = iota
+	// Ignore does not react to the other species.
+	Ignore
+	// Avoid steers away from the other species,
+	// weighted by Settings.SpeciesAvoidWeight.
+	Avoid
+)
+
+func (interaction Interaction) String() string {
+	switch interaction {
+	case Flocking:
+		return "flocking"
+	case Ignore:
+		return "ignore"
+	case Avoid:
+		return "avoid"
+	default:
+		return "unknown"
+	}
+}
+
+// AddSpecies adds a species with count new boids and returns its index.
+// The new species flocks with all others.
+func (flock *Flock) AddSpecies(species Species, count int) (int, error) {
+	n := len(flock.Species)
+	if n >= MaxSpecies {
+		return -1, errors.New("too many species")
+	}
+
+	interactions := make([]Interaction, (n+1)*(n+1))
+	for a := 0; a < n; a++ {
+		copy(interactions[a*(n+1):], flock.interactions[a*n:(a+1)*n])
+	}
+	flock.interactions = interactions
+
+	flock.Species = append(flock.Species, species)
+	flock.speciesStart = append(flock.speciesStart, flock.speciesStart[n])
+	flock.ResizeSpecies(n, count)
+	return n, nil
+}
+
+// Interaction returns how species a reacts to species b.
+func (flock *Flock) Interaction(a, b int) Interaction {
+	return flock.interactions[a*len(flock.Species)+b]
+}
+
+// SetInteraction sets how species a reacts to species b.
+func (flock *Flock) SetInteraction(a, b int, interaction Interaction) {
+	flock.interactions[a*len(flock.Species)+b] = interaction
+}
+
+// SpeciesRange returns the range of boids belonging to species k.
+func (flock *Flock) SpeciesRange(k int) (start, limit int) {
+	return flock.speciesStart[k], flock.speciesStart[k+1]
+}
+
+// ResizeSpecies grows or shrinks species k to count boids,
+// new boids are placed randomly.
+func (flock *Flock) ResizeSpecies(k, count int) {
+	if count < 0 {
+		count = 0
+	}
+	start, limit := flock.SpeciesRange(k)
+	previous := limit - start
+	if count == previous {
+		return
+	}
+
+	if count < previous {
+		end := start + count
+		flock.Position = slices.Delete(flock.Position, end, limit)
+		flock.Heading = slices.Delete(flock.Heading, end, limit)
+		flock.Speed = slices.Delete(flock.Speed, end, limit)
+		flock.SpeciesIndex = slices.Delete(flock.SpeciesIndex, end, limit)
+	} else {
+		added := count - previous
+		flock.Position = slices.Insert(flock.Position, limit, make([]g.Vec3, added)...)
+		flock.Heading = slices.Insert(flock.Heading, limit, make([]g.Vec3, added)...)
+		flock.Speed = slices.Insert(flock.Speed, limit, make([]float32, added)...)
+		flock.SpeciesIndex = slices.Insert(flock.SpeciesIndex, limit, make([]uint8, added)...)
+		for i := limit; i < limit+added; i++ {
+			flock.SpeciesIndex[i] = uint8(k)
+		}
+		flock.randomize(limit, limit+added)
+	}
+
+	for j := k + 1; j < len(flock.speciesStart); j++ {
+		flock.speciesStart[j] += count - previous
+	}
+	flock.CellIndex = resize(flock.CellIndex, len(flock.Position))
+}
+
+// species returns the species of boid i.
+func (flock *Flock) species(i int) *Species {
+	return &flock.Species[flock.SpeciesIndex[i]]
+}
+
+// SpeciesCell is the average of a single species in a cell.
+type SpeciesCell struct {
+	Count     int32
+	Center    g.Vec3
+	Alignment g.Vec3
+}
+
+// speciesNeighbors combines the species in a cell according to
+// how the boid's species interacts with them.
+func (flock *Flock) speciesNeighbors(cell int32, boid Boid) Neighbors {
+	n := len(flock.Species)
+	cells := flock.CellSpecies[int(cell)*n : (int(cell)+1)*n]
+	interactions := flock.interactions[boid.Species*n : (boid.Species+1)*n]
+
+	near := Neighbors{Target: flock.CellTarget[cell], TargetWeight: flock.CellTargetWeight[cell]}
+	count := float32(0)
+	for k := range cells {
+		other := &cells[k]
+		if other.Count == 0 {
+			continue
+		}
+		switch interactions[k] {
+		case Flocking:
+			weight := float32(other.Count)
+			count += weight
+			near.Center = near.Center.Add(other.Center.Mul(weight))
+			near.Alignment = near.Alignment.Add(other.Alignment.Mul(weight))
+		case Avoid:
+			near.Avoid = near.Avoid.Add(boid.Position.Sub(other.Center))
+		}
+	}
+
+	if count > 0 {
+		near.Count = int(count)
+		near.Center = near.Center.Mul(1 / count)
+		near.Alignment = near.Alignment.Mul(1 / count)
+		near.Separation = boid.Position.Sub(near.Center)
+	}
+	return near
+}
+
+// SpeciesAvoidance steers away from boids of avoided species,
+// weighted by Settings.SpeciesAvoidWeight.
+type SpeciesAvoidance struct{}
+
+func (SpeciesAvoidance) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	if near.Avoid == (g.Vec3{}) {
+		return g.Vec3{}, 0
+	}
+	return near.Avoid, flock.Settings.SpeciesAvoidWeight
+}
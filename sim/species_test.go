@@ -0,0 +1,93 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+type neighborRecorder struct{ near []Neighbors }
+
+func (behavior *neighborRecorder) Steer(flock *Flock, boid Boid, near Neighbors) (g.Vec3, float32) {
+	behavior.near[boid.Index] = near
+	return g.Vec3{}, 0
+}
+
+func TestSpeciesInteraction(t *testing.T) {
+	tests := []struct {
+		mode        Mode
+		interaction bool
+		counts      [2]int
+	}{
+		{CellAverage, false, [2]int{4, 4}},
+		{CellAverage, true, [2]int{2, 2}},
+		{Neighborhood, false, [2]int{3, 3}},
+		{Neighborhood, true, [2]int{1, 1}},
+	}
+
+	for _, test := range tests {
+		flock := NewFlock(2, 1)
+		defer flock.Close()
+
+		other, err := flock.AddSpecies(DefaultSpecies(), 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.interaction {
+			flock.SetInteraction(0, other, Avoid)
+			flock.SetInteraction(other, 0, Ignore)
+		}
+
+		recorder := &neighborRecorder{near: make([]Neighbors, 4)}
+		flock.AddBehavior("record", recorder)
+		flock.Settings.Mode = test.mode
+		for i := range flock.Position {
+			flock.Position[i] = g.V3(1+float32(i)*0.5, 1, 1)
+		}
+
+		flock.Step(1.0 / 30.0)
+
+		for i, near := range recorder.near {
+			species := int(flock.SpeciesIndex[i])
+			if near.Count != test.counts[species] {
+				t.Errorf("%v %v: boid %d has %d neighbors, expected %d",
+					test.mode, test.interaction, i, near.Count, test.counts[species])
+			}
+			avoiding := near.Avoid != (g.Vec3{})
+			if avoiding != (test.interaction && species == 0) {
+				t.Errorf("%v %v: boid %d avoid %v", test.mode, test.interaction, i, near.Avoid)
+			}
+		}
+	}
+}
+
+func TestResizeSpecies(t *testing.T) {
+	flock := NewFlock(100, 1)
+	defer flock.Close()
+
+	other, _ := flock.AddSpecies(Species{Name: "other", MinSpeed: 10, MaxSpeed: 10}, 50)
+	flock.Resize(300)
+	flock.ResizeSpecies(0, 150)
+
+	for k, expected := range []int{150, 100} {
+		start, limit := flock.SpeciesRange(k)
+		if limit-start != expected {
+			t.Errorf("species %d has %d boids, expected %d", k, limit-start, expected)
+		}
+		for i := start; i < limit; i++ {
+			if int(flock.SpeciesIndex[i]) != k {
+				t.Fatalf("boid %d has species %d, expected %d", i, flock.SpeciesIndex[i], k)
+			}
+		}
+	}
+
+	start, limit := flock.SpeciesRange(other)
+	for i := start; i < limit; i++ {
+		if flock.Speed[i] != 10 {
+			t.Fatalf("boid %d has speed %v", i, flock.Speed[i])
+		}
+	}
+	if flock.Count() != 250 || len(flock.Heading) != 250 || len(flock.CellIndex) != 250 {
+		t.Errorf("got %d boids", flock.Count())
+	}
+}
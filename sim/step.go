@@ -0,0 +1,31 @@
+package sim
+
+// FixedStep converts variable frame times into a number of
+// fixed size simulation steps.
+type FixedStep struct {
+	Delta float32
+	// MaxSteps limits the number of steps per frame,
+	// to avoid spiraling when the simulation is slower than real-time.
+	MaxSteps int
+
+	accumulated float64
+}
+
+func NewFixedStep(delta float32) *FixedStep {
+	return &FixedStep{
+		Delta:    delta,
+		MaxSteps: 4,
+	}
+}
+
+// Advance adds elapsed seconds and returns how many steps should be taken.
+func (fixed *FixedStep) Advance(elapsed float32) int {
+	fixed.accumulated += float64(elapsed)
+
+	steps := int(fixed.accumulated / float64(fixed.Delta))
+	fixed.accumulated -= float64(steps) * float64(fixed.Delta)
+	if fixed.MaxSteps > 0 && steps > fixed.MaxSteps {
+		steps = fixed.MaxSteps
+	}
+	return steps
+}
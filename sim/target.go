@@ -0,0 +1,339 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/adinfinit/g"
+)
+
+// Target attracts boids towards its Position or repels them from it.
+type Target struct {
+	Position g.Vec3
+	// Path moves the target every step, nil keeps it at Position.
+	Path Path
+	// Weight scales Settings.TargetWeight.
+	Weight float32
+	// Radius limits the influence of the target, 0 means unlimited.
+	Radius float32
+	// Falloff reduces the weight towards Radius.
+	Falloff Falloff
+	// Repel pushes boids away from the target.
+	Repel bool
+}
+
+// Falloff is how the influence of a target decreases with distance.
+type Falloff int32
+
+const (
+	// ConstantFalloff keeps the full weight within the radius.
+	ConstantFalloff Falloff = iota
+	// LinearFalloff decreases the weight linearly to 0 at the radius.
+	LinearFalloff
+	// QuadraticFalloff decreases the weight quadratically to 0 at the radius.
+	QuadraticFalloff
+	// SmoothFalloff decreases the weight with a smoothstep to 0 at the radius.
+	SmoothFalloff
+)
+
+func (falloff Falloff) String() string {
+	switch falloff {
+	case ConstantFalloff:
+		return "constant"
+	case LinearFalloff:
+		return "linear"
+	case QuadraticFalloff:
+		return "quadratic"
+	case SmoothFalloff:
+		return "smooth"
+	default:
+		return "unknown"
+	}
+}
+
+// scale returns the weight multiplier at distance from a target with radius.
+func (falloff Falloff) scale(distance, radius float32) float32 {
+	if radius <= 0 {
+		return 1
+	}
+	t := g.Clamp(1-distance/radius, 0, 1)
+	switch falloff {
+	case LinearFalloff:
+		return t
+	case QuadraticFalloff:
+		return t * t
+	case SmoothFalloff:
+		return t * t * (3 - 2*t)
+	default:
+		return 1
+	}
+}
+
+// maxTargetBlend limits Settings.TargetBlend.
+const maxTargetBlend = 8
+
+// Path computes the position of a target over time.
+type Path interface {
+	// At returns the position at time t in seconds.
+	At(t float64) g.Vec3
+}
+
+// PathFunc adapts a func to Path.
+type PathFunc func(t float64) g.Vec3
+
+func (fn PathFunc) At(t float64) g.Vec3 { return fn(t) }
+
+// Circle moves around Center, U and V are the axes of the circle
+// and their lengths are the radii.
+type Circle struct {
+	Center g.Vec3
+	U, V   g.Vec3
+	// Speed is in radians per second.
+	Speed float32
+	Phase float32
+}
+
+func (circle *Circle) At(t float64) g.Vec3 {
+	sn, cs := math.Sincos(t*float64(circle.Speed) + float64(circle.Phase))
+	return circle.Center.Add(circle.U.Mul(float32(cs))).Add(circle.V.Mul(float32(sn)))
+}
+
+// Lissajous oscillates around Center independently on each axis.
+type Lissajous struct {
+	Center    g.Vec3
+	Amplitude g.Vec3
+	// Frequency is in radians per second.
+	Frequency g.Vec3
+	Phase     g.Vec3
+}
+
+func (curve *Lissajous) At(t float64) g.Vec3 {
+	wave := func(amplitude, frequency, phase float32) float32 {
+		return amplitude * float32(math.Sin(t*float64(frequency)+float64(phase)))
+	}
+	return curve.Center.Add(g.V3(
+		wave(curve.Amplitude.X, curve.Frequency.X, curve.Phase.X),
+		wave(curve.Amplitude.Y, curve.Frequency.Y, curve.Phase.Y),
+		wave(curve.Amplitude.Z, curve.Frequency.Z, curve.Phase.Z),
+	))
+}
+
+// Waypoints moves through Points in a loop at constant speed,
+// taking Duration seconds for the whole loop.
+type Waypoints struct {
+	Points   []g.Vec3
+	Duration float32
+}
+
+func (path *Waypoints) At(t float64) g.Vec3 {
+	n := len(path.Points)
+	if n == 0 {
+		return g.Vec3{}
+	}
+
+	total := float32(0)
+	for i, p := range path.Points {
+		total += path.Points[(i+1)%n].Sub(p).Len()
+	}
+	if total == 0 {
+		return path.Points[0]
+	}
+
+	distance := loopFraction(t, path.Duration) * total
+	for i, p := range path.Points {
+		next := path.Points[(i+1)%n]
+		length := next.Sub(p).Len()
+		if distance <= length && length > 0 {
+			return p.Lerp(next, distance/length)
+		}
+		distance -= length
+	}
+	return path.Points[0]
+}
+
+// Spline moves through Points along a closed Catmull-Rom spline,
+// taking Duration seconds for the whole loop with equal time per segment.
+type Spline struct {
+	Points   []g.Vec3
+	Duration float32
+}
+
+func (spline *Spline) At(t float64) g.Vec3 {
+	n := len(spline.Points)
+	if n == 0 {
+		return g.Vec3{}
+	}
+
+	u := loopFraction(t, spline.Duration) * float32(n)
+	i := int(u)
+	f := u - float32(i)
+	point := func(k int) g.Vec3 { return spline.Points[((k%n)+n)%n] }
+	p0, p1, p2, p3 := point(i-1), point(i), point(i+1), point(i+2)
+
+	f2, f3 := f*f, f*f*f
+	return p1.Mul(2).
+		Add(p2.Sub(p0).Mul(f)).
+		Add(p0.Mul(2).Sub(p1.Mul(5)).Add(p2.Mul(4)).Sub(p3).Mul(f2)).
+		Add(p1.Sub(p2).Mul(3).Add(p3).Sub(p0).Mul(f3)).
+		Mul(0.5)
+}
+
+// Keyframe is a position at a time.
+type Keyframe struct {
+	Time     float32
+	Position g.Vec3
+}
+
+// Keyframes interpolates linearly between keys sorted by time.
+// Before the first and after the last key the position is held,
+// unless Loop repeats the keys.
+type Keyframes struct {
+	Keys []Keyframe
+	Loop bool
+}
+
+func (keyframes *Keyframes) At(t float64) g.Vec3 {
+	keys := keyframes.Keys
+	if len(keys) == 0 {
+		return g.Vec3{}
+	}
+
+	last := keys[len(keys)-1].Time
+	if keyframes.Loop && last > 0 {
+		t = math.Mod(t, float64(last))
+		if t < 0 {
+			t += float64(last)
+		}
+	}
+
+	at := float32(t)
+	if at <= keys[0].Time {
+		return keys[0].Position
+	}
+	for i := 1; i < len(keys); i++ {
+		if at < keys[i].Time {
+			prev := keys[i-1]
+			f := (at - prev.Time) / (keys[i].Time - prev.Time)
+			return prev.Position.Lerp(keys[i].Position, f)
+		}
+	}
+	return keys[len(keys)-1].Position
+}
+
+// loopFraction returns how far t is into a loop of duration, in [0, 1).
+func loopFraction(t float64, duration float32) float32 {
+	if duration <= 0 {
+		return 0
+	}
+	loops := t / float64(duration)
+	return float32(loops - math.Floor(loops))
+}
+
+// defaultTargets returns three targets orbiting the origin.
+func defaultTargets() []Target {
+	return []Target{
+		{Weight: 1, Path: &Circle{U: g.V3(0, 20, 0), V: g.V3(0, 0, 20), Speed: 0.1}},
+		{Weight: 1, Path: &Circle{U: g.V3(0, 0, 25), V: g.V3(25, 0, 0), Speed: 0.1}},
+		{Weight: 1, Path: &Circle{U: g.V3(-30, 0, 0), V: g.V3(0, 30, 0), Speed: 0.1}},
+	}
+}
+
+// AddTarget adds a target and returns its index.
+func (flock *Flock) AddTarget(target Target) int {
+	flock.Targets = append(flock.Targets, target)
+	return len(flock.Targets) - 1
+}
+
+// RemoveTarget removes the i-th target.
+func (flock *Flock) RemoveTarget(i int) {
+	flock.Targets = append(flock.Targets[:i], flock.Targets[i+1:]...)
+}
+
+// moveTargets moves targets along their paths.
+func (flock *Flock) moveTargets() {
+	for i := range flock.Targets {
+		target := &flock.Targets[i]
+		if target.Path != nil {
+			target.Position = target.Path.At(flock.Time)
+		}
+	}
+}
+
+// nearestTarget returns the closest attracting target that has pos within its radius,
+// weight is 0 when there is no such target.
+func (flock *Flock) nearestTarget(pos g.Vec3) (nearest g.Vec3, weight float32) {
+	nearestDistance2 := float32(math.Inf(1))
+	for i := range flock.Targets {
+		target := &flock.Targets[i]
+		dist2 := pos.Sub(target.Position).Len2()
+		if target.Repel || dist2 >= nearestDistance2 || !target.reaches(dist2) {
+			continue
+		}
+		nearest, weight = target.Position, target.Weight
+		nearestDistance2 = dist2
+	}
+	return nearest, weight
+}
+
+// reaches returns whether a point at squared distance dist2 is within the radius.
+func (target *Target) reaches(dist2 float32) bool {
+	return target.Radius <= 0 || dist2 <= target.Radius*target.Radius
+}
+
+// blendTargets blends the Settings.TargetBlend nearest targets of pos into
+// a single point to fly towards. Repelling targets contribute a point on the
+// opposite side of pos. weight is the total weight of the blended targets.
+func (flock *Flock) blendTargets(pos g.Vec3) (point g.Vec3, weight float32) {
+	n := int(g.Clamp(float32(flock.Settings.TargetBlend), 1, maxTargetBlend))
+
+	type candidate struct {
+		dist2 float32
+		index int
+	}
+	var nearest [maxTargetBlend]candidate
+	found := 0
+	for i := range flock.Targets {
+		target := &flock.Targets[i]
+		dist2 := pos.Sub(target.Position).Len2()
+		if !target.reaches(dist2) {
+			continue
+		}
+		// insert into the sorted candidates, dropping the furthest
+		k := found
+		if found < n {
+			found++
+		} else if dist2 >= nearest[n-1].dist2 {
+			continue
+		} else {
+			k = n - 1
+		}
+		for ; k > 0 && nearest[k-1].dist2 > dist2; k-- {
+			nearest[k] = nearest[k-1]
+		}
+		nearest[k] = candidate{dist2: dist2, index: i}
+	}
+
+	for _, candidate := range nearest[:found] {
+		target := &flock.Targets[candidate.index]
+		distance := g.Sqrt(candidate.dist2)
+		w := target.Weight * target.Falloff.scale(distance, target.Radius)
+		if w == 0 {
+			continue
+		}
+
+		towards := target.Position
+		if target.Repel {
+			away := normalize(pos.Sub(target.Position))
+			if away == (g.Vec3{}) {
+				away = g.V3(0, 1, 0)
+			}
+			towards = pos.Add(away.Mul(g.Max(distance, flock.radius)))
+		}
+		point = point.Add(towards.Mul(w))
+		weight += w
+	}
+
+	if weight == 0 {
+		return g.Vec3{}, 0
+	}
+	return point.Mul(1 / weight), weight
+}
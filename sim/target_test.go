@@ -0,0 +1,140 @@
+package sim
+
+import (
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestPaths(t *testing.T) {
+	square := []g.Vec3{g.V3(0, 0, 0), g.V3(4, 0, 0), g.V3(4, 4, 0), g.V3(0, 4, 0)}
+
+	tests := []struct {
+		path     Path
+		t        float64
+		expected g.Vec3
+	}{
+		{&Circle{Center: g.V3(1, 0, 0), U: g.V3(2, 0, 0), V: g.V3(0, 2, 0), Speed: g.Pi}, 0, g.V3(3, 0, 0)},
+		{&Circle{Center: g.V3(1, 0, 0), U: g.V3(2, 0, 0), V: g.V3(0, 2, 0), Speed: g.Pi}, 0.5, g.V3(1, 2, 0)},
+		{&Lissajous{Amplitude: g.V3(1, 2, 3), Frequency: g.V3(g.Pi, g.Pi, 0), Phase: g.V3(0, 0, g.Pi/2)}, 0.5, g.V3(1, 2, 3)},
+		{&Waypoints{Points: square, Duration: 16}, 2, g.V3(2, 0, 0)},
+		{&Waypoints{Points: square, Duration: 16}, 22, g.V3(4, 2, 0)},
+		{&Spline{Points: square, Duration: 4}, 2, g.V3(4, 4, 0)},
+		{&Spline{Points: square, Duration: 4}, 7, g.V3(0, 4, 0)},
+		{&Keyframes{Keys: []Keyframe{{1, g.V3(0, 0, 0)}, {3, g.V3(2, 4, 0)}}}, 2, g.V3(1, 2, 0)},
+		{&Keyframes{Keys: []Keyframe{{1, g.V3(0, 0, 0)}, {3, g.V3(2, 4, 0)}}}, 10, g.V3(2, 4, 0)},
+		{&Keyframes{Keys: []Keyframe{{0, g.V3(0, 0, 0)}, {2, g.V3(2, 4, 0)}}, Loop: true}, 5, g.V3(1, 2, 0)},
+	}
+
+	for _, test := range tests {
+		got := test.path.At(test.t)
+		if got.Sub(test.expected).Len() > 1e-4 {
+			t.Errorf("%T at %v: got %v expected %v", test.path, test.t, got, test.expected)
+		}
+	}
+}
+
+func TestTargetRadius(t *testing.T) {
+	flock := NewFlock(100, 1)
+	defer flock.Close()
+
+	flock.Targets = nil
+	far := flock.AddTarget(Target{Position: g.V3(1000, 0, 0), Weight: 1, Radius: 10})
+
+	recorder := &neighborRecorder{near: make([]Neighbors, flock.Count())}
+	flock.AddBehavior("record", recorder)
+	flock.Step(1.0 / 30.0)
+	for i, near := range recorder.near {
+		if near.TargetWeight != 0 {
+			t.Fatalf("boid %d is attracted by a target out of reach", i)
+		}
+	}
+
+	flock.Targets[far].Radius = 0
+	flock.Step(1.0 / 30.0)
+	for i, near := range recorder.near {
+		if near.TargetWeight != 1 || near.Target != flock.Targets[far].Position {
+			t.Fatalf("boid %d is not attracted by the target", i)
+		}
+	}
+
+	flock.RemoveTarget(far)
+	if len(flock.Targets) != 0 {
+		t.Fatalf("remove failed")
+	}
+	flock.Step(1.0 / 30.0)
+}
+
+func TestFalloff(t *testing.T) {
+	tests := []struct {
+		falloff  Falloff
+		distance float32
+		radius   float32
+		expected float32
+	}{
+		{ConstantFalloff, 5, 10, 1},
+		{LinearFalloff, 5, 0, 1},
+		{LinearFalloff, 5, 10, 0.5},
+		{LinearFalloff, 15, 10, 0},
+		{QuadraticFalloff, 5, 10, 0.25},
+		{SmoothFalloff, 5, 10, 0.5},
+		{SmoothFalloff, 2.5, 10, 0.84375},
+	}
+	for _, test := range tests {
+		if got := test.falloff.scale(test.distance, test.radius); g.Abs(got-test.expected) > 1e-6 {
+			t.Errorf("%v %v/%v: got %v expected %v", test.falloff, test.distance, test.radius, got, test.expected)
+		}
+	}
+}
+
+func TestBlendTargets(t *testing.T) {
+	flock := NewFlock(0, 1)
+	defer flock.Close()
+
+	flock.Targets = []Target{
+		{Position: g.V3(10, 0, 0), Weight: 1},
+		{Position: g.V3(0, 10, 0), Weight: 3},
+		{Position: g.V3(-100, 0, 0), Weight: 1},
+	}
+
+	point, weight := flock.blendTargets(g.Vec3{})
+	if point != g.V3(10, 0, 0) || weight != 1 {
+		t.Errorf("nearest: got %v %v", point, weight)
+	}
+
+	flock.Settings.TargetBlend = 2
+	point, weight = flock.blendTargets(g.Vec3{})
+	if point.Sub(g.V3(2.5, 7.5, 0)).Len() > 1e-5 || weight != 4 {
+		t.Errorf("blend: got %v %v", point, weight)
+	}
+
+	flock.Settings.TargetBlend = 1
+	flock.Targets[0].Repel = true
+	point, weight = flock.blendTargets(g.Vec3{})
+	if point.X >= 0 || weight != 1 {
+		t.Errorf("repel: got %v %v", point, weight)
+	}
+}
+
+func TestRepulsor(t *testing.T) {
+	flock := NewFlock(2000, 1)
+	defer flock.Close()
+
+	flock.Targets = []Target{{Weight: 4, Radius: 30, Falloff: LinearFalloff, Repel: true}}
+	inside := func() (n int) {
+		for _, pos := range flock.Position {
+			if pos.Len() < 10 {
+				n++
+			}
+		}
+		return n
+	}
+
+	before := inside()
+	for i := 0; i < 300; i++ {
+		flock.Step(1.0 / 30.0)
+	}
+	if after := inside(); after > before/10 {
+		t.Errorf("%d boids within the repelling zone, started with %d", after, before)
+	}
+}
@@ -0,0 +1,398 @@
+package sim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Interpolation is how a track changes from one key to the next.
+type Interpolation int32
+
+const (
+	// Linear changes at a constant rate.
+	Linear Interpolation = iota
+	// Smoothstep eases in and out.
+	Smoothstep
+	// Bezier follows a cubic curve shaped by Key.Out and the next Key.In.
+	Bezier
+)
+
+func (interpolation Interpolation) String() string {
+	switch interpolation {
+	case Linear:
+		return "linear"
+	case Smoothstep:
+		return "smoothstep"
+	case Bezier:
+		return "bezier"
+	default:
+		return "unknown"
+	}
+}
+
+func (interpolation Interpolation) MarshalText() ([]byte, error) {
+	return []byte(interpolation.String()), nil
+}
+
+func (interpolation *Interpolation) UnmarshalText(text []byte) error {
+	for _, i := range []Interpolation{Linear, Smoothstep, Bezier} {
+		if string(text) == i.String() {
+			*interpolation = i
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown interpolation %q", text)
+}
+
+// Key is the value of a track at Time seconds.
+type Key struct {
+	Time  float64
+	Value float32
+	// Interpolation is used from this key to the next.
+	Interpolation Interpolation
+	// In and Out are the Bezier handles before and after the key,
+	// relative to Value.
+	In, Out float32
+}
+
+// Track animates a single value.
+type Track struct {
+	// Name is the path of the value, such as "Settings.CellRadius",
+	// "Targets.0.Weight" or "Targets.1.Path.Speed".
+	Name string
+	// Keys are sorted by time.
+	Keys []Key
+}
+
+// At returns the value at time t, the first and last values
+// are held before and after the keys.
+func (track *Track) At(t float64) float32 {
+	keys := track.Keys
+	if len(keys) == 0 {
+		return 0
+	}
+	if t <= keys[0].Time {
+		return keys[0].Value
+	}
+	for i := 1; i < len(keys); i++ {
+		if t < keys[i].Time {
+			from, to := &keys[i-1], &keys[i]
+			f := float32((t - from.Time) / (to.Time - from.Time))
+			return from.Interpolation.blend(from, to, f)
+		}
+	}
+	return keys[len(keys)-1].Value
+}
+
+// blend returns the value at fraction f between from and to.
+func (interpolation Interpolation) blend(from, to *Key, f float32) float32 {
+	switch interpolation {
+	case Smoothstep:
+		f = f * f * (3 - 2*f)
+	case Bezier:
+		p0, p1 := from.Value, from.Value+from.Out
+		p2, p3 := to.Value+to.In, to.Value
+		u := 1 - f
+		return u*u*u*p0 + 3*u*u*f*p1 + 3*u*f*f*p2 + f*f*f*p3
+	}
+	return from.Value + (to.Value-from.Value)*f
+}
+
+// Timeline animates values with keyframes, so that a performance
+// can be repeated exactly.
+//
+// A flock animates the tracks starting with "Settings." and "Targets.",
+// other tracks can be applied by the caller, see Apply.
+type Timeline struct {
+	// Duration loops the timeline, 0 plays it once.
+	Duration float64
+	Tracks   []Track
+}
+
+// ReadTimeline reads a timeline in JSON format.
+func ReadTimeline(r io.Reader) (*Timeline, error) {
+	timeline := &Timeline{}
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(timeline); err != nil {
+		return nil, fmt.Errorf("unable to parse timeline: %w", err)
+	}
+	if err := timeline.Validate(); err != nil {
+		return nil, err
+	}
+	return timeline, nil
+}
+
+// Validate checks that the tracks have names and sorted finite keys.
+func (timeline *Timeline) Validate() error {
+	var errs []error
+	if !(timeline.Duration >= 0) || math.IsInf(timeline.Duration, 0) {
+		errs = append(errs, fmt.Errorf("invalid timeline duration %v", timeline.Duration))
+	}
+	for i := range timeline.Tracks {
+		track := &timeline.Tracks[i]
+		if track.Name == "" {
+			errs = append(errs, fmt.Errorf("track %d has no name", i))
+		}
+		for k, key := range track.Keys {
+			finite := !math.IsNaN(key.Time) && !math.IsInf(key.Time, 0)
+			for _, v := range []float32{key.Value, key.In, key.Out} {
+				finite = finite && !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+			}
+			if !finite {
+				errs = append(errs, fmt.Errorf("track %q key %d is not finite", track.Name, k))
+			}
+			if k > 0 && !(key.Time > track.Keys[k-1].Time) {
+				errs = append(errs, fmt.Errorf("track %q key %d is not after the previous key", track.Name, k))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// local returns the time within the timeline.
+func (timeline *Timeline) local(t float64) float64 {
+	if timeline.Duration <= 0 {
+		return t
+	}
+	t = math.Mod(t, timeline.Duration)
+	if t < 0 {
+		t += timeline.Duration
+	}
+	return t
+}
+
+// Apply sets the values of tracks named prefix+path at time t,
+// where path selects a field of root, such as "Eye.X" with prefix "Camera.".
+// root must be a pointer.
+func (timeline *Timeline) Apply(root any, prefix string, t float64) error {
+	if timeline == nil {
+		return nil
+	}
+	return timeline.apply(root, prefix, timeline.local(t))
+}
+
+// apply sets the values of tracks named prefix+path at local time t.
+func (timeline *Timeline) apply(root any, prefix string, t float64) error {
+	var errs []error
+	for i := range timeline.Tracks {
+		track := &timeline.Tracks[i]
+		path, ok := strings.CutPrefix(track.Name, prefix)
+		if !ok {
+			continue
+		}
+		if err := setPath(reflect.ValueOf(root), parsePath(path), track.At(t)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to animate %q: %w", track.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// pathStep is a field or an index of a track path.
+type pathStep struct {
+	name string
+	// index is the slice index, -1 when name is not a number.
+	index int
+	// owner is the struct type the field was last looked up in.
+	owner reflect.Type
+	field []int
+}
+
+// parsePath splits a dot separated path of fields and indices.
+func parsePath(path string) []pathStep {
+	var steps []pathStep
+	for rest, more := path, true; more; {
+		var name string
+		name, rest, more = strings.Cut(rest, ".")
+		index, err := strconv.Atoi(name)
+		if err != nil || index < 0 {
+			index = -1
+		}
+		steps = append(steps, pathStep{name: name, index: index})
+	}
+	return steps
+}
+
+// setPath sets the number at the path of fields and indices.
+// The fields are looked up once per struct type and cached in steps.
+func setPath(v reflect.Value, steps []pathStep, value float32) error {
+	for i := range steps {
+		step := &steps[i]
+
+		for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+			if v.IsNil() {
+				return fmt.Errorf("nil value before %q", step.name)
+			}
+			v = v.Elem()
+		}
+
+		switch v.Kind() {
+		case reflect.Struct:
+			if step.owner != v.Type() {
+				field, ok := v.Type().FieldByName(step.name)
+				if !ok || !field.IsExported() {
+					return fmt.Errorf("unknown field %q", step.name)
+				}
+				step.owner, step.field = v.Type(), field.Index
+			}
+			v = v.FieldByIndex(step.field)
+		case reflect.Slice, reflect.Array:
+			if step.index < 0 || step.index >= v.Len() {
+				return fmt.Errorf("invalid index %q", step.name)
+			}
+			v = v.Index(step.index)
+		default:
+			return fmt.Errorf("unable to select %q from %v", step.name, v.Type())
+		}
+	}
+
+	if !v.CanSet() {
+		return fmt.Errorf("unable to set %v", v.Type())
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(float64(value))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(math.Round(float64(value))))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(math.Round(math.Max(float64(value), 0))))
+	case reflect.Bool:
+		v.SetBool(value >= 0.5)
+	default:
+		return fmt.Errorf("unable to animate %v", v.Type())
+	}
+	return nil
+}
+
+// boundTrack is a settings or target track of the flock timeline
+// with its path parsed, see Flock.bind.
+type boundTrack struct {
+	track *Track
+	// targets is set for tracks animating Targets instead of Settings.
+	targets bool
+	steps   []pathStep
+}
+
+// bind parses the paths of the settings and target tracks of timeline,
+// so that animating them does not allocate.
+func (flock *Flock) bind(timeline *Timeline) {
+	flock.bound = timeline
+	flock.boundTracks = flock.boundTracks[:0]
+	if timeline == nil {
+		return
+	}
+	for i := range timeline.Tracks {
+		track := &timeline.Tracks[i]
+		if path, ok := strings.CutPrefix(track.Name, "Settings."); ok {
+			flock.boundTracks = append(flock.boundTracks, boundTrack{track: track, steps: parsePath(path)})
+		} else if path, ok := strings.CutPrefix(track.Name, "Targets."); ok {
+			flock.boundTracks = append(flock.boundTracks, boundTrack{track: track, targets: true, steps: parsePath(path)})
+		}
+	}
+}
+
+// SetTimeline sets the timeline animating the settings and targets,
+// and applies it at the current time. nil stops the animation.
+//
+// The animated settings are validated at each key of the settings tracks
+// and between them. When they are invalid the timeline is not set.
+// When a target track can not be applied, the timeline is not set,
+// but the other tracks have been applied.
+//
+// The track paths are resolved once, SetTimeline must be called again
+// after tracks are added, removed or renamed.
+func (flock *Flock) SetTimeline(timeline *Timeline) error {
+	if err := flock.checkSettings(timeline); err != nil {
+		return err
+	}
+	flock.bind(timeline)
+	if err := flock.animate(timeline); err != nil {
+		return err
+	}
+	flock.Timeline = timeline
+	flock.TimelineError = nil
+	return nil
+}
+
+// settingsSamples is the number of times each segment between keys
+// of the settings tracks is validated, bezier curves may overshoot the keys.
+const settingsSamples = 8
+
+// checkSettings validates the settings animated by timeline over its keys.
+func (flock *Flock) checkSettings(timeline *Timeline) error {
+	if timeline == nil {
+		return nil
+	}
+	for i := range timeline.Tracks {
+		track := &timeline.Tracks[i]
+		if !strings.HasPrefix(track.Name, "Settings.") {
+			continue
+		}
+		for k, key := range track.Keys {
+			for sample := 0; sample < settingsSamples; sample++ {
+				t := key.Time
+				if k+1 < len(track.Keys) {
+					t += (track.Keys[k+1].Time - key.Time) * float64(sample) / settingsSamples
+				} else if sample > 0 {
+					break
+				}
+
+				settings := flock.Settings
+				if err := timeline.apply(&settings, "Settings.", t); err != nil {
+					return err
+				}
+				if err := settings.Validate(); err != nil {
+					return fmt.Errorf("invalid settings at %vs: %w", t, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// animate applies the settings and target tracks of timeline,
+// settings that do not validate are not applied.
+func (flock *Flock) animate(timeline *Timeline) error {
+	if timeline == nil {
+		return nil
+	}
+	if flock.bound != timeline {
+		flock.bind(timeline)
+	}
+
+	t := timeline.local(flock.Time)
+	flock.animated = flock.Settings
+	settings := reflect.ValueOf(&flock.animated)
+	targets := reflect.ValueOf(&flock.Targets)
+
+	var settingsErr, targetsErr error
+	for i := range flock.boundTracks {
+		bound := &flock.boundTracks[i]
+		root := settings
+		if bound.targets {
+			root = targets
+		}
+		if err := setPath(root, bound.steps, bound.track.At(t)); err != nil {
+			err = fmt.Errorf("unable to animate %q: %w", bound.track.Name, err)
+			if bound.targets {
+				targetsErr = errors.Join(targetsErr, err)
+			} else {
+				settingsErr = errors.Join(settingsErr, err)
+			}
+		}
+	}
+	if settingsErr == nil {
+		if err := flock.animated.Validate(); err != nil {
+			settingsErr = fmt.Errorf("invalid settings at %vs: %w", flock.Time, err)
+		} else {
+			flock.Settings = flock.animated
+		}
+	}
+	return errors.Join(settingsErr, targetsErr)
+}
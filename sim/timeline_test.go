@@ -0,0 +1,146 @@
+package sim
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/adinfinit/g"
+)
+
+func TestTrackInterpolation(t *testing.T) {
+	tests := []struct {
+		key  Key
+		at   float64
+		want float32
+	}{
+		{Key{Interpolation: Linear}, 2.5, 2.5},
+		{Key{Interpolation: Smoothstep}, 2.5, 1.5625},
+		{Key{Interpolation: Smoothstep}, 5, 5},
+		// zero handles ease like smoothstep
+		{Key{Interpolation: Bezier}, 5, 5},
+		{Key{Interpolation: Bezier}, 2.5, 1.5625},
+		{Key{Interpolation: Bezier, Out: 10}, 2.5, 5.78125},
+	}
+	for _, test := range tests {
+		track := Track{Keys: []Key{test.key, {Time: 10, Value: 10}}}
+		if got := track.At(test.at); g.Abs(got-test.want) > 1e-4 {
+			t.Errorf("%v at %v: got %v, expected %v", test.key.Interpolation, test.at, got, test.want)
+		}
+	}
+
+	track := Track{Keys: []Key{{Time: 1, Value: 3}, {Time: 2, Value: 5}}}
+	if got := track.At(0); got != 3 {
+		t.Errorf("before first key: got %v, expected 3", got)
+	}
+	if got := track.At(3); got != 5 {
+		t.Errorf("after last key: got %v, expected 5", got)
+	}
+}
+
+func TestTimelineFlock(t *testing.T) {
+	flock := NewFlock(10, 1)
+	defer flock.Close()
+
+	timeline, err := ReadTimeline(strings.NewReader(`{
+		"Duration": 4,
+		"Tracks": [
+			{"Name": "Settings.CellRadius", "Keys": [{"Time": 0, "Value": 5}, {"Time": 2, "Value": 9}]},
+			{"Name": "Settings.Mode", "Keys": [{"Time": 0, "Value": 1}]},
+			{"Name": "Targets.0.Weight", "Keys": [{"Time": 0, "Value": 0, "Interpolation": "smoothstep"}, {"Time": 2, "Value": 4}]},
+			{"Name": "Targets.0.Path.Speed", "Keys": [{"Time": 0, "Value": 0.5}]},
+			{"Name": "Camera.Eye.X", "Keys": [{"Time": 0, "Value": 1}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := flock.SetTimeline(timeline); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		flock.Step(1.0 / 5)
+	}
+	if g.Abs(flock.Settings.CellRadius-7) > 1e-4 {
+		t.Errorf("CellRadius: got %v, expected 7", flock.Settings.CellRadius)
+	}
+	if flock.Settings.Mode != Neighborhood {
+		t.Errorf("Mode: got %v, expected %v", flock.Settings.Mode, Neighborhood)
+	}
+	if g.Abs(flock.Targets[0].Weight-2) > 1e-4 {
+		t.Errorf("target weight: got %v, expected 2", flock.Targets[0].Weight)
+	}
+	if speed := flock.Targets[0].Path.(*Circle).Speed; speed != 0.5 {
+		t.Errorf("path speed: got %v, expected 0.5", speed)
+	}
+
+	// loops after Duration
+	for i := 0; i < 20; i++ {
+		flock.Step(1.0 / 5)
+	}
+	if g.Abs(flock.Settings.CellRadius-7) > 1e-4 {
+		t.Errorf("looped CellRadius: got %v, expected 7", flock.Settings.CellRadius)
+	}
+
+	var camera struct{ Eye struct{ X, Y, Z float32 } }
+	if err := timeline.Apply(&camera, "Camera.", flock.Time); err != nil {
+		t.Fatal(err)
+	}
+	if camera.Eye.X != 1 {
+		t.Errorf("camera: got %v, expected 1", camera.Eye.X)
+	}
+}
+
+func TestTimelineErrors(t *testing.T) {
+	flock := NewFlock(10, 1)
+	defer flock.Close()
+
+	for _, name := range []string{"Settings.Radius", "Targets.7.Weight", "Targets.0.Path", "Settings.rng"} {
+		timeline := &Timeline{Tracks: []Track{{Name: name, Keys: []Key{{Value: 1}}}}}
+		if err := flock.SetTimeline(timeline); err == nil {
+			t.Errorf("%v: expected error", name)
+		}
+	}
+	if flock.Timeline != nil {
+		t.Errorf("invalid timeline was set")
+	}
+
+	// valid at the keys, but the curve drops CellRadius below CellRadiusWobble
+	overshoot := &Timeline{Tracks: []Track{{Name: "Settings.CellRadius", Keys: []Key{
+		{Time: 0, Value: 5, Interpolation: Bezier, Out: -10},
+		{Time: 1, Value: 5, In: -10},
+	}}}}
+	if err := flock.SetTimeline(overshoot); err == nil || flock.Timeline != nil {
+		t.Errorf("expected error for invalid settings between keys, got %v", err)
+	}
+
+	// errors during Step are reported once
+	last := flock.AddTarget(Target{Weight: 1})
+	name := "Targets." + strconv.Itoa(last) + ".Weight"
+	timeline := &Timeline{Tracks: []Track{{Name: name, Keys: []Key{{Value: 2}}}}}
+	if err := flock.SetTimeline(timeline); err != nil {
+		t.Fatal(err)
+	}
+	reported := 0
+	flock.OnTimelineError = func(flock *Flock, err error) { reported++ }
+	flock.RemoveTarget(last)
+	for i := 0; i < 3; i++ {
+		flock.Step(1.0 / 60)
+	}
+	if reported != 1 || flock.TimelineError == nil {
+		t.Errorf("reported %d errors, last %v", reported, flock.TimelineError)
+	}
+
+	for _, data := range []string{
+		`{"Tracks": [{"Name": "Settings.CellRadius", "Keys": [{"Time": 1}, {"Time": 0}]}]}`,
+		`{"Tracks": [{"Keys": [{"Time": 0}]}]}`,
+		`{"Tracks": [{"Name": "Settings.CellRadius", "Keys": [{"Interpolation": "cubic"}]}]}`,
+		`{"Duration": -1}`,
+		`{"Loop": true}`,
+	} {
+		if _, err := ReadTimeline(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: expected error", data)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	loadPath = flag.String("load", "", "start from snapshot")
+	savePath = flag.String("save", "", "write snapshot at the end of headless run, or with S key (default boids.snapshot.gz)")
+)
+
+func snapshotPath() string {
+	if *savePath == "" {
+		return "boids.snapshot.gz"
+	}
+	return *savePath
+}
+
+// saveSnapshot writes the flock to path, compressing when path ends with ".gz".
+func saveSnapshot(flock *sim.Flock, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create snapshot %q: %v", path, err)
+	}
+
+	w := bufio.NewWriter(file)
+	if strings.HasSuffix(path, ".gz") {
+		err = flock.SaveCompressed(w)
+	} else {
+		err = flock.Save(w)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write snapshot %q: %v", path, err)
+	}
+	return nil
+}
+
+func loadSnapshot(flock *sim.Flock, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open snapshot %q: %w", path, err)
+	}
+	defer file.Close()
+
+	if err := flock.Load(bufio.NewReader(file)); err != nil {
+		return fmt.Errorf("unable to load snapshot %q: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/adinfinit/g"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var speciesCount = flag.Int("species", 1, "number of species, each avoids the next one")
+
+var demoSpecies = []sim.Species{
+	{Name: "minnow", Separation: 1, Alignment: 1.5, Cohesion: 1, Target: 1, MinSpeed: 6, MaxSpeed: 9, Size: 0.4, Color: g.V4(0.3, 0.7, 1, 0.8)},
+	{Name: "perch", Separation: 1.5, Alignment: 1, Cohesion: 0.5, Target: 1, MinSpeed: 4, MaxSpeed: 6, Size: 0.7, Color: g.V4(1, 0.8, 0.2, 0.8)},
+	{Name: "carp", Separation: 0.5, Alignment: 0.5, Cohesion: 2, Target: 0.5, MinSpeed: 3, MaxSpeed: 5, Size: 0.9, Color: g.V4(0.4, 1, 0.4, 0.8)},
+}
+
+// addDemoSpecies splits the flock into n species,
+// where each species avoids the next one and the next one ignores it.
+func addDemoSpecies(flock *sim.Flock, n int) error {
+	if n <= 1 {
+		return nil
+	}
+	if n > len(demoSpecies)+1 {
+		return fmt.Errorf("at most %d species are supported", len(demoSpecies)+1)
+	}
+
+	count := flock.Count() / n
+	flock.ResizeSpecies(0, count)
+	for _, species := range demoSpecies[:n-1] {
+		if _, err := flock.AddSpecies(species, count); err != nil {
+			return err
+		}
+	}
+	for k := 0; k+1 < n; k++ {
+		flock.SetInteraction(k, k+1, sim.Avoid)
+		flock.SetInteraction(k+1, k, sim.Ignore)
+	}
+	return nil
+}
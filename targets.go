@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/adinfinit/g"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var (
+	targetPaths = flag.String("targets", "orbits", "target paths: orbits, lissajous, waypoints, spline, static or zone")
+	targetBlend = flag.Int("target-blend", 1, "number of nearest targets blended together")
+)
+
+// applyTargets configures the targets from flags.
+func applyTargets(flock *sim.Flock) error {
+	corners := []g.Vec3{
+		g.V3(-25, -10, -25), g.V3(25, 10, -25),
+		g.V3(25, -10, 25), g.V3(-25, 10, 25),
+	}
+
+	flock.Settings.TargetBlend = int32(*targetBlend)
+
+	switch *targetPaths {
+	case "orbits":
+	case "zone":
+		// keep away from the center while following the orbits
+		flock.AddTarget(sim.Target{Weight: 3, Radius: 15, Falloff: sim.SmoothFalloff, Repel: true})
+	case "lissajous":
+		flock.Targets = []sim.Target{{Weight: 1, Path: &sim.Lissajous{
+			Amplitude: g.V3(30, 20, 30),
+			Frequency: g.V3(0.3, 0.4, 0.5),
+			Phase:     g.V3(0, g.Pi/2, 0),
+		}}}
+	case "waypoints":
+		flock.Targets = []sim.Target{{Weight: 1, Path: &sim.Waypoints{Points: corners, Duration: 40}}}
+	case "spline":
+		flock.Targets = []sim.Target{{Weight: 1, Path: &sim.Spline{Points: corners, Duration: 40}}}
+	case "static":
+		flock.Targets = []sim.Target{{Weight: 1}}
+	default:
+		return fmt.Errorf("unknown targets %q", *targetPaths)
+	}
+	return nil
+}
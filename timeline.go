@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/adinfit/boids/sim"
+)
+
+var timelinePath = flag.String("timeline", "", "JSON timeline animating settings, targets, camera and light")
+
+// timelinePrefixes are the tracks that can be animated,
+// "Camera." and "Light." are applied by the window.
+var timelinePrefixes = []string{"Settings.", "Targets.", "Camera.", "Light."}
+
+// startTimeline loads the timeline from flags and sets it on the flock.
+func startTimeline(flock *sim.Flock) error {
+	if *timelinePath == "" {
+		return nil
+	}
+
+	file, err := os.Open(*timelinePath)
+	if err != nil {
+		return fmt.Errorf("unable to read timeline: %w", err)
+	}
+	defer file.Close()
+
+	timeline, err := sim.ReadTimeline(file)
+	if err != nil {
+		return fmt.Errorf("invalid timeline %q: %w", *timelinePath, err)
+	}
+	for _, track := range timeline.Tracks {
+		known := false
+		for _, prefix := range timelinePrefixes {
+			known = known || strings.HasPrefix(track.Name, prefix)
+		}
+		if !known {
+			return fmt.Errorf("unknown timeline track %q", track.Name)
+		}
+	}
+
+	if err := flock.SetTimeline(timeline); err != nil {
+		return fmt.Errorf("invalid timeline %q: %w", *timelinePath, err)
+	}
+	flock.OnTimelineError = func(flock *sim.Flock, err error) {
+		log.Printf("unable to animate timeline %q: %v", *timelinePath, err)
+	}
+	return nil
+}
+
+// animateView applies the camera and light tracks of timeline.
+func animateView(timeline *sim.Timeline, world *World, t float64) error {
+	return errors.Join(
+		timeline.Apply(&world.Camera, "Camera.", t),
+		timeline.Apply(&world.DiffuseLightPosition, "Light.", t),
+	)
+}